@@ -0,0 +1,155 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// accountType feeds the accounts matched by an hledger query into one of
+// the balance families.
+type accountType struct {
+	Family string `json:"family"`
+	Query  string `json:"query"`
+	// Prefix is trimmed from account names for the account label.
+	Prefix string `json:"prefix"`
+}
+
+func defaultAccountTypes() []accountType {
+	return []accountType{
+		{Family: "expenses", Query: "expenses", Prefix: "expenses:"},
+		{Family: "assets", Query: "assets", Prefix: "assets:"},
+		{Family: "income", Query: "income", Prefix: "income:"},
+		{Family: "liabilities", Query: "liabilities", Prefix: "liabilities:"},
+	}
+}
+
+// balanceFamilies are the families ACCOUNT_TYPES can feed, in the order
+// the balances collector fills them.
+var balanceFamilies = []struct {
+	name            string
+	accounts, total *gaugeFamily
+}{
+	{"expenses", expenseGauge, ledgerTotalExpenses},
+	{"assets", assetGauge, ledgerTotalAssets},
+	{"income", incomeGauge, ledgerTotalIncome},
+	{"liabilities", liabilityGauge, ledgerTotalLiabilities},
+	{"equity", equityGauge, ledgerTotalEquity},
+}
+
+// parseAccountTypes reads entries like
+//
+//	expenses=ausgaben,assets=vermögen,income=einnahmen,income=revenues
+//
+// where the query may contain several space separated hledger query terms
+// and the prefix defaults to the first of them plus a colon. Write
+// "family=query|prefix" to trim something else. Empty means the defaults.
+func parseAccountTypes(v string) ([]accountType, error) {
+	if strings.TrimSpace(v) == "" {
+		return defaultAccountTypes(), nil
+	}
+	var types []accountType
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		family, query, ok := strings.Cut(item, "=")
+		family = strings.TrimSpace(family)
+		query, prefix, hasPrefix := strings.Cut(query, "|")
+		query = strings.TrimSpace(query)
+		if !ok || query == "" {
+			return nil, fmt.Errorf("expected family=query, got %q", item)
+		}
+		for _, term := range strings.Fields(query) {
+			if err := checkQueryTerm(term); err != nil {
+				return nil, fmt.Errorf("%s: %w", family, err)
+			}
+		}
+		known := false
+		for _, f := range balanceFamilies {
+			known = known || f.name == family
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown family %q in %q", family, item)
+		}
+		if !hasPrefix {
+			prefix = strings.Fields(query)[0] + ":"
+		}
+		types = append(types, accountType{Family: family, Query: query, Prefix: strings.TrimSpace(prefix)})
+	}
+	return types, nil
+}
+
+// under is the prefix an account must have to belong to t. It is the
+// trimmed prefix, or the first query term when nothing is trimmed.
+func (t accountType) under() string {
+	if t.Prefix != "" {
+		return t.Prefix
+	}
+	return strings.Fields(t.Query)[0] + ":"
+}
+
+// familyQuery returns the query terms of every ACCOUNT_TYPES entry feeding
+// family, for the reports besides the balances. hledger matches accounts
+// matching any of them.
+func familyQuery(family string) []string {
+	var terms []string
+	for _, t := range cfg.AccountTypes {
+		if t.Family == family {
+			terms = append(terms, strings.Fields(t.Query)...)
+		}
+	}
+	return terms
+}
+
+// familyLabel returns the account label of an account of family, i.e. the
+// account without the prefix of the ACCOUNT_TYPES entry it falls under. A
+// top level account like "expenses" itself is returned unchanged. ok is
+// false for accounts of other families.
+func familyLabel(family, account string) (label string, ok bool) {
+	return familyLabelIn(cfg.AccountTypes, family, account)
+}
+
+func familyLabelIn(types []accountType, family, account string) (string, bool) {
+	for _, t := range types {
+		if t.Family != family {
+			continue
+		}
+		if strings.HasPrefix(account, t.under()) {
+			return strings.TrimPrefix(account, t.Prefix), true
+		}
+		if account == strings.TrimSuffix(t.under(), ":") {
+			return account, true
+		}
+	}
+	return "", false
+}
+
+// trimFamilyPrefix is familyLabelIn for configured account names, which
+// may be given with or without the prefix.
+func trimFamilyPrefix(types []accountType, family, account string) string {
+	if label, ok := familyLabelIn(types, family, account); ok {
+		return label
+	}
+	return account
+}
+
+// familyCategory is familyLabel for subaccounts only, the way the
+// per-category metrics see accounts.
+func familyCategory(family, account string) (string, bool) {
+	for _, t := range cfg.AccountTypes {
+		if t.Family == family && strings.HasPrefix(account, t.under()) {
+			return strings.TrimPrefix(account, t.Prefix), true
+		}
+	}
+	return "", false
+}
+
+// inFamily reports whether account, or its top level account, is one of
+// family's.
+func inFamily(family, account string) bool {
+	_, ok := familyLabel(family, account)
+	return ok
+}
@@ -0,0 +1,93 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func germanAccountTypes(t *testing.T) {
+	t.Helper()
+	types, err := parseAccountTypes("expenses=ausgaben,assets=vermögen,income=einnahmen,liabilities=schulden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := cfg
+	t.Cleanup(func() { cfg = old })
+	cfg.AccountTypes = types
+	cfg.JunkDrawers = defaultJunkDrawers(types)
+}
+
+func TestFamilyLabels(t *testing.T) {
+	germanAccountTypes(t)
+	cases := []struct {
+		family, account string
+		label           string
+		ok, category    bool
+	}{
+		{"expenses", "ausgaben:lebensmittel", "lebensmittel", true, true},
+		{"expenses", "ausgaben", "ausgaben", true, false},
+		{"expenses", "expenses:food", "", false, false},
+		{"expenses", "vermögen:giro", "", false, false},
+		{"assets", "vermögen:giro", "giro", true, true},
+		{"liabilities", "schulden:visa", "visa", true, true},
+	}
+	for _, tc := range cases {
+		label, ok := familyLabel(tc.family, tc.account)
+		if label != tc.label || ok != tc.ok {
+			t.Errorf("familyLabel(%s, %s) = %q, %v, want %q, %v", tc.family, tc.account, label, ok, tc.label, tc.ok)
+		}
+		if _, ok := familyCategory(tc.family, tc.account); ok != tc.category {
+			t.Errorf("familyCategory(%s, %s) ok = %v, want %v", tc.family, tc.account, ok, tc.category)
+		}
+	}
+	if got := familyQuery("expenses"); !slices.Equal(got, []string{"ausgaben"}) {
+		t.Errorf("familyQuery(expenses) = %q", got)
+	}
+	if !slices.Equal(cfg.JunkDrawers, []string{"ausgaben:misc", "ausgaben:unknown"}) {
+		t.Errorf("junk drawers = %q", cfg.JunkDrawers)
+	}
+}
+
+const germanPrint = `"txnidx","date","date2","status","code","description","comment","account","amount","commodity","credit","debit","posting-status","posting-comment"
+"1","2024-03-02","","","","Bäckerei","","ausgaben:lebensmittel","4.20","€","","4.20","",""
+"1","2024-03-02","","","","Bäckerei","","vermögen:giro","-4.20","€","4.20","","",""
+"2","2024-03-05","","","","Umbuchung","","vermögen:giro","-100","€","100","","",""
+"2","2024-03-05","","","","Umbuchung","","schulden:visa","100","€","","100","",""
+`
+
+// The derived metrics must follow ACCOUNT_TYPES like the balances do.
+func TestDerivedCollectorsUseAccountTypes(t *testing.T) {
+	germanAccountTypes(t)
+	defer func(exec func(...string) ([]byte, []byte, error)) { hledgerExec = exec }(hledgerExec)
+	var queries []string
+	hledgerExec = func(args ...string) ([]byte, []byte, error) {
+		i := slices.Index(args, "--")
+		queries = append(queries, strings.Join(args[i+1:], " "))
+		return []byte(germanPrint), nil, nil
+	}
+
+	if err := collectExpenseTotalsByPayee(); err != nil {
+		t.Fatal(err)
+	}
+	if err := collectExpenseFunding(); err != nil {
+		t.Fatal(err)
+	}
+	if err := collectTransfers(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"ausgaben", "ausgaben", "vermögen schulden"}; !slices.Equal(queries, want) {
+		t.Errorf("queries = %q, want %q", queries, want)
+	}
+	if v, ok := published(ledgerExpensesGrossMonthly, "lebensmittel", "EUR", "2024-03"); !ok || v != 4.2 {
+		t.Errorf("gross = %g (%v)", v, ok)
+	}
+	if v, ok := published(ledgerExpenseFunding, "lebensmittel", "vermögen:giro", "EUR", "2024-03"); !ok || v != 4.2 {
+		t.Errorf("funding = %g (%v)", v, ok)
+	}
+	if v, ok := published(ledgerTransfersMonthly, "vermögen:giro", "schulden:visa", "EUR", "2024-03"); !ok || v != 100 {
+		t.Errorf("transfers = %g (%v)", v, ok)
+	}
+}
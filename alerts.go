@@ -0,0 +1,82 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ledgerAccountOverdrawn = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_account_overdrawn",
+			Help: "1 if the asset account's balance is below -OVERDRAFT_TOLERANCE, 0 otherwise",
+		},
+		[]string{"account", "currency"},
+	)
+
+	ledgerLiabilityOverLimit = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_liability_over_limit",
+			Help: "1 if the amount owed on a liability account exceeds its configured limit, 0 otherwise",
+		},
+		[]string{"account", "currency"},
+	)
+)
+
+// parseLimits reads "liabilities:visa=2000,liabilities:amex=5000" into a
+// map keyed like the account label of ledger_liabilities, i.e. without the
+// prefix of the liabilities ACCOUNT_TYPES entry.
+func parseLimits(v string, types []accountType) (map[string]float64, error) {
+	limits := map[string]float64{}
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		account, amount, ok := strings.Cut(item, "=")
+		account = trimFamilyPrefix(types, "liabilities", strings.TrimSpace(account))
+		if !ok || account == "" {
+			return nil, fmt.Errorf("expected account=limit, got %q", item)
+		}
+		limit, err := strconv.ParseFloat(strings.TrimSpace(amount), 64)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid limit for %s: %q", account, amount)
+		}
+		limits[account] = limit
+	}
+	return limits, nil
+}
+
+// publishBalanceAlerts derives the overdraft and credit limit flags from
+// the balances just published. hledger keeps liabilities negative, so the
+// amount owed is the negated balance.
+func publishBalanceAlerts() {
+	overdrawn := newSampleSet()
+	for _, s := range assetGauge.snapshot() {
+		flag := 0.0
+		if s.value < -cfg.OverdraftTolerance {
+			flag = 1
+		}
+		overdrawn.set(flag, s.labels...)
+	}
+	ledgerAccountOverdrawn.publish(overdrawn)
+
+	overLimit := newSampleSet()
+	for _, s := range liabilityGauge.snapshot() {
+		limit, ok := cfg.LiabilityLimits[s.labels[0]]
+		if !ok {
+			continue
+		}
+		flag := 0.0
+		if -s.value > limit {
+			flag = 1
+		}
+		overLimit.set(flag, s.labels...)
+	}
+	ledgerLiabilityOverLimit.publish(overLimit)
+}
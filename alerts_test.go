@@ -0,0 +1,82 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// published returns the value f exports for the label values, and
+// whether it exports them at all.
+func published(f *gaugeFamily, lvs ...string) (float64, bool) {
+	for _, s := range f.snapshot() {
+		if slices.Equal(s.labels, lvs) {
+			return s.value, true
+		}
+	}
+	return 0, false
+}
+
+func TestOverdrawnWithPendingTransactions(t *testing.T) {
+	defer func(tolerance float64) { cfg.OverdraftTolerance = tolerance }(cfg.OverdraftTolerance)
+	balances := newSampleSet()
+	balances.set(1200, "bank:checking", "EUR")
+	// a card payment booked before the salary it is paid from
+	balances.set(-3.5, "bank:savings", "EUR")
+	balances.set(-250, "bank:joint", "EUR")
+	balances.set(0, "cash", "EUR")
+	assetGauge.publish(balances)
+
+	cases := []struct {
+		tolerance float64
+		want      map[string]float64
+	}{
+		{0, map[string]float64{"bank:checking": 0, "bank:savings": 1, "bank:joint": 1, "cash": 0}},
+		{5, map[string]float64{"bank:checking": 0, "bank:savings": 0, "bank:joint": 1, "cash": 0}},
+		// exactly at the tolerance is still fine
+		{3.5, map[string]float64{"bank:savings": 0}},
+		{300, map[string]float64{"bank:savings": 0, "bank:joint": 0}},
+	}
+	for _, tc := range cases {
+		cfg.OverdraftTolerance = tc.tolerance
+		publishBalanceAlerts()
+		for account, want := range tc.want {
+			if got, ok := published(ledgerAccountOverdrawn, account, "EUR"); !ok || got != want {
+				t.Errorf("tolerance %g: %s overdrawn = %g (%v), want %g", tc.tolerance, account, got, ok, want)
+			}
+		}
+	}
+}
+
+func TestLiabilityOverLimit(t *testing.T) {
+	defer func(limits map[string]float64) { cfg.LiabilityLimits = limits }(cfg.LiabilityLimits)
+	var err error
+	if cfg.LiabilityLimits, err = parseLimits("liabilities:visa=2000, amex=500", defaultAccountTypes()); err != nil {
+		t.Fatal(err)
+	}
+	balances := newSampleSet()
+	balances.set(-2000.01, "visa", "EUR")
+	// a refund leaves the card slightly in credit
+	balances.set(12.5, "amex", "EUR")
+	balances.set(-9000, "mortgage", "EUR")
+	liabilityGauge.publish(balances)
+	publishBalanceAlerts()
+
+	for account, want := range map[string]float64{"visa": 1, "amex": 0} {
+		if got, ok := published(ledgerLiabilityOverLimit, account, "EUR"); !ok || got != want {
+			t.Errorf("%s over limit = %g (%v), want %g", account, got, ok, want)
+		}
+	}
+	if _, ok := published(ledgerLiabilityOverLimit, "mortgage", "EUR"); ok {
+		t.Error("mortgage has no limit but is exported")
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	for _, bad := range []string{"visa", "visa=", "visa=-5", "=100", "visa=lots"} {
+		if _, err := parseLimits(bad, defaultAccountTypes()); err == nil {
+			t.Errorf("parseLimits(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ledgerAssetFlowsMonthly = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_asset_flows_monthly",
+			Help: "Net amount moved into each asset account per month, at cost: what was saved, without price changes",
+		},
+		[]string{"account", "currency", "month"},
+	)
+
+	ledgerAssetsHistorical = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_assets_historical",
+			Help: "Balance of each asset account at the end of every month, valued like ledger_assets",
+		},
+		[]string{"account", "currency", "month"},
+	)
+)
+
+// collectAssetMonthly runs the monthly asset report twice: once as
+// changes per month with --cost for the flows, and once with --historical
+// and the VALUATION settings for the end balances. Flows deliberately
+// ignore valuation, else a price move would show up as money saved, and
+// are converted to cost, else buying shares would show up as money spent.
+func collectAssetMonthly() error {
+	log.Println("collectAssetMonthly called")
+	flows, err := assetMonthlyReport("--monthly", "--cost")
+	if err != nil {
+		return err
+	}
+	balances, err := assetMonthlyReport(append([]string{"--monthly", "--historical"}, valuationArgs()...)...)
+	if err != nil {
+		return err
+	}
+	ledgerAssetFlowsMonthly.publish(flows)
+	ledgerAssetsHistorical.publish(balances)
+	return nil
+}
+
+// assetMonthlyReport runs `hledger bal` over the same asset accounts as
+// ledger_assets with the given report options and reads its tidy CSV, one
+// row per account, commodity and month.
+func assetMonthlyReport(opts ...string) (*sampleSet, error) {
+	set := newSampleSet()
+	for _, t := range cfg.AccountTypes {
+		if t.Family != "assets" {
+			continue
+		}
+		args := append([]string{"bal", "--layout", "tidy", "--output-format", "csv"}, opts...)
+		args = append(append(args, "--"), strings.Fields(t.Query)...)
+		report, err := parseTidyBalance(args, t.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.Query, err)
+		}
+		set.merge(report)
+	}
+	return set, nil
+}
+
+func parseTidyBalance(args []string, prefix string) (*sampleSet, error) {
+	out, err := runHledger("assetmonthly", args...)
+	if err != nil {
+		return nil, fmt.Errorf("hledger bal: %w", err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading csv: %w", err)
+	}
+	set := newSampleSet()
+	if len(records) == 0 {
+		return set, nil
+	}
+	cols := csvColumns(records[0])
+	accountCol, okAccount := cols["account"]
+	startCol, okStart := cols["start_date"]
+	commodityCol, okCommodity := cols["commodity"]
+	valueCol, okValue := cols["value"]
+	if !okAccount || !okStart || !okCommodity || !okValue {
+		return nil, fmt.Errorf("unexpected tidy balance report header %q", records[0])
+	}
+	for _, rec := range records[1:] {
+		if len(rec) != len(records[0]) {
+			warnf("skipping balance row with %d columns: %q", len(rec), rec)
+			continue
+		}
+		account := strings.TrimSpace(rec[accountCol])
+		start := strings.TrimSpace(rec[startCol])
+		if account == "" || len(start) < len("2006-01") {
+			// a total row
+			continue
+		}
+		amount, err := parseAmount(strings.TrimSpace(rec[valueCol]))
+		if err != nil {
+			warnf("could not parse balance %q of %s: %v", rec[valueCol], account, err)
+			continue
+		}
+		currency := currencyCode(strings.TrimSpace(rec[commodityCol]))
+		set.addFrom(account, amount, strings.TrimPrefix(account, prefix), currency, start[:len("2006-01")])
+	}
+	return set, nil
+}
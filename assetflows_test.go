@@ -0,0 +1,34 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAssetFlowsAtCost(t *testing.T) {
+	setValuation(t, "end", false)
+	defer func(exec func(...string) ([]byte, []byte, error)) { hledgerExec = exec }(hledgerExec)
+	var runs [][]string
+	hledgerExec = func(args ...string) ([]byte, []byte, error) {
+		if err := checkHledgerArgs(args); err != nil {
+			t.Error(err)
+		}
+		runs = append(runs, args)
+		return nil, nil, nil
+	}
+	if err := collectAssetMonthly(); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range runs {
+		opts := args[:slices.Index(args, "--")]
+		historical := slices.Contains(opts, "--historical")
+		if cost := slices.Contains(opts, "--cost"); cost == historical {
+			t.Errorf("%q: --cost = %v, want it on the flows only", args, cost)
+		}
+	}
+	if len(runs) == 0 {
+		t.Error("hledger never ran")
+	}
+}
@@ -0,0 +1,90 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var ledgerExpensesMonthlyAvg = newGaugeFamily(
+	prometheus.GaugeOpts{
+		Name: "ledger_expenses_monthly_avg",
+		Help: "Average monthly expenses by category and currency over all complete months",
+	},
+	[]string{"category", "currency"},
+)
+
+// csvColumns maps the header of a CSV report to column indexes, so
+// columns are found by name rather than by position.
+func csvColumns(header []string) map[string]int {
+	cols := map[string]int{}
+	for i, h := range header {
+		cols[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	return cols
+}
+
+// collectMonthlyAverages reads the average column of the monthly balance
+// report. The report ends with the current month, which is still running,
+// so the average only covers complete months. Under REPORT_END the books
+// are closed up to it: a month ending right at REPORT_END is complete,
+// though the pinned clock still calls it current.
+func collectMonthlyAverages(now time.Time) error {
+	log.Println("collectMonthlyAverages called")
+	if !cfg.ReportEnd.IsZero() {
+		now = cfg.ReportEnd
+	}
+	end := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	// the same -s and --depth as ledger_expenses, so the categories match
+	args := append([]string{"-s", "bal", "--depth", "5", "--monthly", "--average",
+		"--end", end.Format("2006-01-02"), "--layout", "bare", "--output-format", "csv"}, valuationArgs()...)
+	out, err := runHledger("monthly", append(append(args, "--"), familyQuery("expenses")...)...)
+	if err != nil {
+		return fmt.Errorf("hledger bal --average: %w", err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+	if err != nil {
+		return fmt.Errorf("reading csv: %w", err)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	cols := csvColumns(records[0])
+	accountCol, okAccount := cols["account"]
+	commodityCol, okCommodity := cols["commodity"]
+	avgCol, okAvg := cols["average"]
+	if !okAccount || !okCommodity || !okAvg {
+		return fmt.Errorf("unexpected balance report header %q", records[0])
+	}
+
+	set := newSampleSet()
+	for _, rec := range records[1:] {
+		if len(rec) != len(records[0]) {
+			warnf("skipping balance row with %d columns: %q", len(rec), rec)
+			continue
+		}
+		account := strings.TrimSpace(rec[accountCol])
+		category, ok := familyCategory("expenses", account)
+		if !ok {
+			// the total row, or the bare "expenses" parent
+			continue
+		}
+		amount, err := parseAmount(strings.TrimSpace(rec[avgCol]))
+		if err != nil {
+			warnf("could not parse average %q of %s: %v", rec[avgCol], account, err)
+			continue
+		}
+		currency := map[string]string{"€": "EUR", "$": "USD"}[strings.TrimSpace(rec[commodityCol])]
+		set.set(amount, category, currency)
+	}
+	ledgerExpensesMonthlyAvg.publish(set)
+	return nil
+}
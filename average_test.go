@@ -0,0 +1,51 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMonthlyAveragesEnd(t *testing.T) {
+	cases := []struct {
+		name      string
+		reportEnd string
+		now       time.Time
+		want      string
+	}{
+		{"live", "", time.Date(2025, 6, 15, 12, 0, 0, 0, time.Local), "2025-06-01"},
+		{"closed at a month end", "2025-06-01", time.Date(2025, 6, 1, 0, 0, 0, -1, time.Local), "2025-06-01"},
+		{"closed mid month", "2025-06-15", time.Date(2025, 6, 15, 0, 0, 0, -1, time.Local), "2025-06-01"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			old := cfg
+			defer func() { cfg = old }()
+			cfg.AccountTypes = defaultAccountTypes()
+			end, err := parseReportEnd(c.reportEnd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg.ReportEnd = end
+
+			defer func(exec func(...string) ([]byte, []byte, error)) { hledgerExec = exec }(hledgerExec)
+			var args []string
+			hledgerExec = func(a ...string) ([]byte, []byte, error) {
+				args = a
+				return nil, nil, nil
+			}
+			if err := collectMonthlyAverages(c.now); err != nil {
+				t.Fatal(err)
+			}
+			i := slices.Index(args, "--end")
+			if i < 0 || i+1 >= len(args) || args[i+1] != c.want {
+				t.Errorf("ran %q, want --end %s", args, c.want)
+			}
+			if !slices.Contains(args, "-s") || slices.Index(args, "--depth") < 0 || args[slices.Index(args, "--depth")+1] != "5" {
+				t.Errorf("ran %q, want -s --depth 5 like ledger_expenses", args)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	parseWarnings = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ledger_exporter_parse_warnings_total",
+			Help: "hledger output lines that were skipped because they couldn't be parsed",
+		},
+	)
+	collectorPanics = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ledger_exporter_collector_panics_total",
+			Help: "Collector runs that panicked",
+		},
+		[]string{"collector"},
+	)
+
+	// warningCount mirrors parseWarnings for -probe, which needs to read it.
+	warningCount atomic.Int64
+)
+
+// warnf logs a skipped line or record and counts it. Semantic and
+// configuration notices go to log.Printf instead, so the counter only
+// moves when hledger output could not be parsed.
+func warnf(format string, args ...any) {
+	parseWarnings.Inc()
+	warningCount.Add(1)
+	log.Printf(format, args...)
+}
+
+// collector is one step of a refresh: a function that runs hledger and
+// publishes the families it owns.
+type collector struct {
+	name     string
+	run      func() error
+	families []*gaugeFamily
+	// active reports whether the collector has anything to do with the
+	// current configuration; nil means always.
+	active func() bool
+	// mayBeEmpty marks collectors that legitimately export nothing for
+	// some journals, so -probe doesn't fail on them.
+	mayBeEmpty bool
+
+	mu           sync.Mutex
+	lastDuration time.Duration
+	lastErr      error
+}
+
+// isEnabled reports whether COLLECTORS enables the collector.
+func (c *collector) isEnabled() bool {
+	return cfg.Collectors == nil || cfg.Collectors[c.name]
+}
+
+// isActive reports whether the collector should run this refresh.
+func (c *collector) isActive() bool {
+	return c.isEnabled() && (c.active == nil || c.active())
+}
+
+// collect runs the collector and remembers how it went. A panic is turned
+// into an error so the other collectors and the HTTP server keep going;
+// whatever the collector published before stays exported.
+func (c *collector) collect() (err error) {
+	start := time.Now()
+	forgetArgv(c.name)
+	defer func() {
+		if r := recover(); r != nil {
+			collectorPanics.WithLabelValues(c.name).Inc()
+			log.Printf("collector %s panicked: %v\n%s", c.name, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+		c.mu.Lock()
+		c.lastDuration = time.Since(start)
+		c.lastErr = err
+		c.mu.Unlock()
+	}()
+	return c.run()
+}
+
+// runCollectors runs the active collectors in order. A failing or
+// panicking one doesn't stop the others.
+func runCollectors(cs []*collector) []error {
+	var errs []error
+	for _, c := range cs {
+		if !c.isActive() {
+			continue
+		}
+		if err := c.collect(); err != nil {
+			log.Printf("collector %s: %v", c.name, err)
+			errs = append(errs, fmt.Errorf("collector %s: %w", c.name, err))
+		}
+	}
+	return errs
+}
+
+func (c *collector) status() (time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastDuration, c.lastErr
+}
+
+// samples counts the series the collector currently exports.
+func (c *collector) samples() int {
+	n := 0
+	for _, f := range c.families {
+		n += f.len()
+	}
+	return n
+}
+
+var collectors = []*collector{
+	{
+		// first, so every other collector reads the journal without them
+		name:       "duplicates",
+		run:        collectDuplicates,
+		families:   []*gaugeFamily{ledgerDuplicateTransactions},
+		active:     func() bool { return cfg.Duplicates != "" },
+		mayBeEmpty: true,
+	},
+	{
+		name: "balances",
+		run: func() error {
+			for _, f := range balanceFamilies {
+				if err := collectBalances(f.name, f.accounts, f.total); err != nil {
+					return err
+				}
+				if f.name == "expenses" {
+					publishExpenseGroups()
+				}
+			}
+			publishBalanceAlerts()
+			publishLiquidity()
+			return nil
+		},
+		families: []*gaugeFamily{
+			expenseGauge, assetGauge, incomeGauge, liabilityGauge, equityGauge,
+			ledgerTotalExpenses, ledgerTotalAssets, ledgerTotalIncome, ledgerTotalLiabilities, ledgerTotalEquity,
+			ledgerExpensesGrouped, ledgerAccountOverdrawn, ledgerLiabilityOverLimit,
+			ledgerTotalAssetsLiquid, ledgerTotalAssetsIlliquid,
+		},
+	},
+	{
+		name: "monthly",
+		run:  collectMonthlyExpenses,
+		families: []*gaugeFamily{
+			ledgerExpensesMonthly, ledgerExpensesTrendSlope, ledgerExpensesTrendR2,
+			ledgerExpensesGroupedMonthly, ledgerExpensesMonthlyAvg, ledgerExpensesMonthlyReal,
+			ledgerExpenseShare,
+		},
+	},
+	{
+		name:     "mtd",
+		run:      collectMonthToDate,
+		families: []*gaugeFamily{ledgerExpensesMTD, ledgerExpensesMTDLastMonth, ledgerExpensesMTDRatio},
+		// nothing spent yet on the 1st is fine
+		mayBeEmpty: true,
+	},
+	{
+		name:     "weekly",
+		run:      collectWeekly,
+		families: []*gaugeFamily{ledgerExpensesWoWDelta, ledgerIncomeLastWeek, ledgerTotalAssets7dDelta},
+		// a quiet week, or no asset history yet
+		mayBeEmpty: true,
+	},
+	{
+		name:     "assetmonthly",
+		run:      collectAssetMonthly,
+		families: []*gaugeFamily{ledgerAssetFlowsMonthly, ledgerAssetsHistorical},
+	},
+	{
+		name: "payee",
+		run:  collectExpenseTotalsByPayee,
+		families: []*gaugeFamily{
+			ledgerExpenseByPayee, ledgerExpensesGrossMonthly, ledgerRefundsMonthly,
+			ledgerExpenseTransactionsMonthly,
+		},
+	},
+	{
+		name:     "uncategorized",
+		run:      collectUncategorized,
+		families: []*gaugeFamily{ledgerUncategorizedExpenses, ledgerUncategorizedPostings},
+		// everything categorized is the goal
+		mayBeEmpty: true,
+	},
+	{
+		name:     "funding",
+		run:      collectExpenseFunding,
+		families: []*gaugeFamily{ledgerExpenseFunding},
+	},
+	{
+		name:       "transfers",
+		run:        collectTransfers,
+		families:   []*gaugeFamily{ledgerTransfersMonthly},
+		mayBeEmpty: true,
+	},
+	{
+		name:       "conversions",
+		run:        collectCurrencyExchanges,
+		families:   []*gaugeFamily{ledgerCurrencyExchanged},
+		mayBeEmpty: true,
+	},
+	{
+		name:       "holdings",
+		run:        collectHoldings,
+		families:   []*gaugeFamily{ledgerHoldings, ledgerHoldingsCost},
+		mayBeEmpty: true,
+	},
+	{
+		name:     "prices",
+		run:      collectPriceStaleness,
+		families: []*gaugeFamily{ledgerCommodityPriceTimestamp, ledgerCommodityPriceMissing},
+		active:   func() bool { return cfg.ValuationCurrency != "" },
+		// holding nothing but the valuation currency is fine
+		mayBeEmpty: true,
+	},
+	{
+		name:     "sources",
+		run:      collectSourceLastPosting,
+		families: []*gaugeFamily{ledgerSourceLastPosting},
+		active:   func() bool { return len(cfg.SourceTags) > 0 },
+	},
+}
@@ -0,0 +1,74 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestCollectorPanic(t *testing.T) {
+	family := newGaugeFamily(prometheus.GaugeOpts{Name: "test_panicking", Help: "test"}, []string{"currency"})
+	set := newSampleSet()
+	set.set(42, "EUR")
+	family.publish(set)
+
+	panicking := &collector{
+		name: "test_panicking",
+		run: func() error {
+			var rec []string
+			_ = rec[7] // a short CSV row
+			return nil
+		},
+		families: []*gaugeFamily{family},
+	}
+	ran := false
+	next := &collector{name: "test_next", run: func() error { ran = true; return nil }}
+	before := counterValue(t, collectorPanics.WithLabelValues("test_panicking"))
+
+	errs := runCollectors([]*collector{panicking, next})
+
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "panic") {
+		t.Errorf("errors = %v, want one panic", errs)
+	}
+	if !ran {
+		t.Error("the collector after the panicking one didn't run")
+	}
+	if got := counterValue(t, collectorPanics.WithLabelValues("test_panicking")); got != before+1 {
+		t.Errorf("collector_panics_total = %g, want %g", got, before+1)
+	}
+	if _, err := panicking.status(); err == nil {
+		t.Error("status doesn't report the panic")
+	}
+	if v, ok := published(family, "EUR"); !ok || v != 42 {
+		t.Errorf("previous metrics = %g (%v), want them kept", v, ok)
+	}
+}
+
+func TestCollectorPanicInHledger(t *testing.T) {
+	defer func(exec func(...string) ([]byte, []byte, error)) { hledgerExec = exec }(hledgerExec)
+	hledgerExec = func(args ...string) ([]byte, []byte, error) { panic("hledger runner exploded") }
+	before := counterValue(t, collectorPanics.WithLabelValues("payee"))
+	for _, c := range collectors {
+		if c.name == "payee" {
+			if errs := runCollectors([]*collector{c}); len(errs) != 1 {
+				t.Errorf("errors = %v", errs)
+			}
+		}
+	}
+	if got := counterValue(t, collectorPanics.WithLabelValues("payee")); got != before+1 {
+		t.Errorf("collector_panics_total = %g, want %g", got, before+1)
+	}
+}
@@ -0,0 +1,496 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// config is everything the exporter reads from its environment.
+//
+// Credentials must never show up in logs or /debug/config. MarshalJSON
+// redacts every field tagged `secret:"true"` and, as a safety net, every
+// field whose name looks like it holds a credential.
+type config struct {
+	GiteaToken      string `secret:"true"`
+	GiteaJournalURL string
+
+	ListenAddr string
+
+	// OTLPEndpoint receives the metrics after every refresh over
+	// OTLP/gRPC, nothing is pushed without it.
+	OTLPEndpoint string
+	// OTLPHeaders are sent with every push, e.g. for authentication.
+	OTLPHeaders    map[string]string `secret:"true"`
+	OTLPCAFile     string
+	OTLPClientCert string
+	OTLPClientKey  string
+	// SandboxDir overrides where the journal is kept and hledger runs.
+	SandboxDir string
+	// TenantsFile switches to serving the exporters configured in it, see
+	// runTenants.
+	TenantsFile string
+	// MaxJournalBytes is the largest journal or CSV import a fetch
+	// accepts, 0 accepts anything.
+	MaxJournalBytes int64
+
+	// APIToken guards the JSON endpoints, which are only served when it
+	// is set.
+	APIToken string `secret:"true"`
+
+	// MaxSeriesPerMetric caps how many series a single metric may export;
+	// 0 disables the cap.
+	MaxSeriesPerMetric int
+	// SeriesCapHysteresis is how many refreshes in a row a series has to
+	// fall below the MaxSeriesPerMetric cutoff before it is dropped.
+	SeriesCapHysteresis int
+	// SeriesGraceCycles is how many refreshes a vanished series keeps its
+	// last value before it is dropped.
+	SeriesGraceCycles int
+
+	// SourceTags are the values of the `source:` tag whose newest posting
+	// is tracked, e.g. one per bank importer.
+	SourceTags []string
+
+	// EmitAverages adds an hledger --average run to the monthly collector.
+	EmitAverages bool
+
+	// OverdraftTolerance is how far below zero an asset account may go,
+	// e.g. while card payments are pending, before it counts as overdrawn.
+	OverdraftTolerance float64
+	// LiabilityLimits maps liability accounts (without "liabilities:") to
+	// the most that may be owed on them.
+	LiabilityLimits map[string]float64
+
+	// MemberDimension adds a member label to the expense metrics.
+	MemberDimension memberDimension
+	// Members limits the member label to these names, anything else is
+	// shared. Empty accepts every name.
+	Members []string
+
+	// Currencies limits every metric with a currency label to these
+	// currencies, ExcludeCurrencies leaves these out; empty means all.
+	Currencies        []string
+	ExcludeCurrencies []string
+
+	// JunkDrawers are expense accounts that count as uncategorized, along
+	// with their subaccounts.
+	JunkDrawers []string
+
+	// LiquidAccounts are the asset accounts counted as liquid.
+	LiquidAccounts accountPatterns
+
+	// CategoryGroups is loaded from CATEGORY_GROUPS_FILE, nil without one.
+	CategoryGroups *categoryGroups
+
+	// HoldingsCommodities limits ledger_holdings to these commodities;
+	// empty tracks everything that isn't a known currency.
+	HoldingsCommodities []string
+
+	// HistoryLength is how many refreshes /api/v1/history remembers for
+	// each of HistorySeries.
+	HistoryLength int
+	HistorySeries []string
+
+	// RetainMonths limits month and day bucketed series to the last
+	// RetainMonths months, the current one included; 0 keeps them all.
+	RetainMonths int
+
+	// StrictIncludes refuses journals including files outside the sandbox.
+	StrictIncludes bool
+
+	// ReportEnd freezes the reports at a date for closed books, see
+	// withReportEnd; zero follows the journal up to today.
+	ReportEnd time.Time
+
+	// Duplicates is "", "warn" or "exclude", see parseDuplicates.
+	// DuplicateWindowDays is how many days apart duplicates may be dated.
+	Duplicates          string
+	DuplicateWindowDays int
+
+	// StateDir keeps what the exporter remembers across restarts; empty
+	// keeps it in memory only.
+	StateDir string
+
+	// CSVImports are raw urls of bank CSV exports converted with the rules
+	// file next to them and appended to the journal on every refresh.
+	CSVImports []string
+
+	// OutboundRateLimit caps requests to Gitea per second, 0 disables it.
+	OutboundRateLimit float64
+	OutboundBurst     int
+
+	// InflationIndexes maps a currency code to the commodity tracking its
+	// price index, for ledger_expenses_monthly_real.
+	InflationIndexes map[string]string
+
+	// AccountTypes maps hledger queries onto the balance families.
+	AccountTypes []accountType
+
+	// Valuation is "" for cost, "end" or "then" for market value of the
+	// balance and monthly reports, see valuationArgs.
+	Valuation string
+	// InferMarketPrices uses transaction prices as market prices.
+	InferMarketPrices bool
+
+	// ValuationCurrency is the currency held commodities are valued in;
+	// the prices collector only runs when it is set.
+	ValuationCurrency string
+
+	// ExtraArgs are the EXTRA_ARGS_* options added to every hledger run
+	// of a collector.
+	ExtraArgs map[string][]string
+
+	// Collectors maps every collector name to whether it is enabled; nil
+	// enables all of them.
+	Collectors map[string]bool
+
+	// OpenMetricsTimestamps stamps month and day bucketed samples with the
+	// end of their period instead of leaving the scrape time.
+	OpenMetricsTimestamps bool
+
+	RefreshInterval time.Duration
+	// MinRefreshInterval spaces out refreshes however they are triggered.
+	MinRefreshInterval time.Duration
+	// LivenessTimeout is how long the refresh loop may go without a
+	// heartbeat, i.e. the longest a single refresh may take, before /livez
+	// reports it as stuck.
+	LivenessTimeout time.Duration
+	// StaleAfter withholds the ledger metrics once the journal couldn't be
+	// fetched for that long, 0 never does.
+	StaleAfter time.Duration
+	// ReadyMaxAge is how old the last successful refresh may be for /readyz
+	// to report ready.
+	ReadyMaxAge time.Duration
+}
+
+var cfg = defaultConfig()
+
+func defaultConfig() config {
+	return config{
+		ListenAddr:         ":9000",
+		MaxSeriesPerMetric: 5000,
+		MaxJournalBytes:    50 << 20,
+		RefreshInterval:    5 * time.Minute,
+		MinRefreshInterval: 10 * time.Second,
+		LivenessTimeout:    10 * time.Minute,
+		ReadyMaxAge:        15 * time.Minute,
+		AccountTypes:       defaultAccountTypes(),
+		OutboundRateLimit:  2,
+		OutboundBurst:      5,
+		HistoryLength:      30,
+		HistorySeries:      defaultHistorySeries(),
+		JunkDrawers:        defaultJunkDrawers(defaultAccountTypes()),
+	}
+}
+
+func loadConfig() (config, error) {
+	c := defaultConfig()
+	var err error
+	c.GiteaToken = os.Getenv("GITEA_TOKEN")
+	c.GiteaJournalURL = os.Getenv("GITEA_JOURNAL_URL")
+	c.APIToken = os.Getenv("API_TOKEN")
+	if addr := os.Getenv("LISTEN_ADDR"); addr != "" {
+		c.ListenAddr = addr
+	}
+	c.SandboxDir = os.Getenv("SANDBOX_DIR")
+	c.TenantsFile = os.Getenv("TENANTS_FILE")
+	c.OTLPEndpoint = os.Getenv("OTLP_ENDPOINT")
+	c.OTLPCAFile = os.Getenv("OTLP_CA_FILE")
+	c.OTLPClientCert = os.Getenv("OTLP_CLIENT_CERT")
+	c.OTLPClientKey = os.Getenv("OTLP_CLIENT_KEY")
+	if (c.OTLPClientCert == "") != (c.OTLPClientKey == "") {
+		return c, fmt.Errorf("OTLP_CLIENT_CERT and OTLP_CLIENT_KEY go together")
+	}
+	if c.OTLPHeaders, err = parseHeaders(os.Getenv("OTLP_HEADERS")); err != nil {
+		return c, fmt.Errorf("OTLP_HEADERS: %w", err)
+	}
+	c.SourceTags = envList("SOURCE_TAGS")
+	c.CSVImports = envList("CSV_IMPORTS")
+	c.StateDir = os.Getenv("STATE_DIR")
+	c.HoldingsCommodities = envList("HOLDINGS_COMMODITIES")
+	c.ValuationCurrency = os.Getenv("VALUATION_CURRENCY")
+	if c.ValuationCurrency != "" {
+		if err := checkQueryTerm(c.ValuationCurrency); err != nil {
+			return c, fmt.Errorf("VALUATION_CURRENCY: %w", err)
+		}
+	}
+	if c.AccountTypes, err = parseAccountTypes(os.Getenv("ACCOUNT_TYPES")); err != nil {
+		return c, fmt.Errorf("ACCOUNT_TYPES: %w", err)
+	}
+	if c.Valuation, err = parseValuation(os.Getenv("VALUATION")); err != nil {
+		return c, fmt.Errorf("VALUATION: %w", err)
+	}
+	if c.InferMarketPrices, err = envBool("INFER_MARKET_PRICES", c.InferMarketPrices); err != nil {
+		return c, err
+	}
+	if c.InflationIndexes, err = parseInflationIndexes(os.Getenv("INFLATION_INDEXES")); err != nil {
+		return c, fmt.Errorf("INFLATION_INDEXES: %w", err)
+	}
+	if c.MemberDimension, err = parseMemberDimension(os.Getenv("MEMBER_DIMENSION")); err != nil {
+		return c, fmt.Errorf("MEMBER_DIMENSION: %w", err)
+	}
+	c.Members = envList("MEMBERS")
+	c.Currencies = envList("CURRENCIES")
+	c.ExcludeCurrencies = envList("EXCLUDE_CURRENCIES")
+	c.JunkDrawers = defaultJunkDrawers(c.AccountTypes)
+	if _, ok := os.LookupEnv("JUNK_DRAWER_ACCOUNTS"); ok {
+		c.JunkDrawers = envList("JUNK_DRAWER_ACCOUNTS")
+	}
+	if c.LiquidAccounts, err = parseAccountPatterns(envList("LIQUID_ACCOUNTS")); err != nil {
+		return c, fmt.Errorf("LIQUID_ACCOUNTS: %w", err)
+	}
+	if c.HistorySeries, err = parseHistorySeries(envList("HISTORY_SERIES")); err != nil {
+		return c, fmt.Errorf("HISTORY_SERIES: %w", err)
+	}
+	if c.Collectors, err = parseCollectors(os.Getenv("COLLECTORS")); err != nil {
+		return c, err
+	}
+	if c.ReportEnd, err = parseReportEnd(os.Getenv("REPORT_END")); err != nil {
+		return c, fmt.Errorf("REPORT_END: %w", err)
+	}
+	if c.Duplicates, err = parseDuplicates(os.Getenv("DUPLICATE_TRANSACTIONS")); err != nil {
+		return c, fmt.Errorf("DUPLICATE_TRANSACTIONS: %w", err)
+	}
+	if c.DuplicateWindowDays, err = envInt("DUPLICATE_WINDOW_DAYS", c.DuplicateWindowDays); err != nil {
+		return c, err
+	}
+	if c.DuplicateWindowDays < 0 {
+		return c, fmt.Errorf("DUPLICATE_WINDOW_DAYS must not be negative")
+	}
+	if c.ExtraArgs, err = parseExtraArgs(c); err != nil {
+		return c, err
+	}
+	if path := os.Getenv("CATEGORY_GROUPS_FILE"); path != "" {
+		def := os.Getenv("CATEGORY_GROUPS_DEFAULT")
+		if def == "" {
+			def = "other"
+		}
+		if c.CategoryGroups, err = loadCategoryGroups(path, def, c.AccountTypes); err != nil {
+			return c, fmt.Errorf("CATEGORY_GROUPS_FILE: %w", err)
+		}
+	}
+
+	if c.MaxSeriesPerMetric, err = envInt("MAX_SERIES_PER_METRIC", c.MaxSeriesPerMetric); err != nil {
+		return c, err
+	}
+	if c.MaxSeriesPerMetric < 0 {
+		return c, fmt.Errorf("MAX_SERIES_PER_METRIC must not be negative")
+	}
+	if c.SeriesCapHysteresis, err = envInt("SERIES_CAP_HYSTERESIS", c.SeriesCapHysteresis); err != nil {
+		return c, err
+	}
+	if c.SeriesGraceCycles, err = envInt("SERIES_GRACE_CYCLES", c.SeriesGraceCycles); err != nil {
+		return c, err
+	}
+	if c.SeriesCapHysteresis < 0 || c.SeriesGraceCycles < 0 {
+		return c, fmt.Errorf("SERIES_CAP_HYSTERESIS and SERIES_GRACE_CYCLES must not be negative")
+	}
+	maxJournal, err := envInt("MAX_JOURNAL_BYTES", int(c.MaxJournalBytes))
+	if err != nil {
+		return c, err
+	}
+	if maxJournal < 0 {
+		return c, fmt.Errorf("MAX_JOURNAL_BYTES must not be negative")
+	}
+	c.MaxJournalBytes = int64(maxJournal)
+	if c.OpenMetricsTimestamps, err = envBool("OPENMETRICS_TIMESTAMPS", c.OpenMetricsTimestamps); err != nil {
+		return c, err
+	}
+	if c.StrictIncludes, err = envBool("STRICT_INCLUDES", c.StrictIncludes); err != nil {
+		return c, err
+	}
+	if c.HistoryLength, err = envInt("HISTORY_LENGTH", c.HistoryLength); err != nil {
+		return c, err
+	}
+	if c.HistoryLength < 1 {
+		return c, fmt.Errorf("HISTORY_LENGTH must be at least 1")
+	}
+	if c.RetainMonths, err = envInt("RETAIN_MONTHS", c.RetainMonths); err != nil {
+		return c, err
+	}
+	if c.RetainMonths < 0 {
+		return c, fmt.Errorf("RETAIN_MONTHS must not be negative")
+	}
+	if c.OutboundRateLimit, err = envFloat("GITEA_RATE_LIMIT", c.OutboundRateLimit); err != nil {
+		return c, err
+	}
+	if c.OutboundBurst, err = envInt("GITEA_RATE_BURST", c.OutboundBurst); err != nil {
+		return c, err
+	}
+	if c.OverdraftTolerance, err = envFloat("OVERDRAFT_TOLERANCE", c.OverdraftTolerance); err != nil {
+		return c, err
+	}
+	if c.LiabilityLimits, err = parseLimits(os.Getenv("LIMITS"), c.AccountTypes); err != nil {
+		return c, fmt.Errorf("LIMITS: %w", err)
+	}
+	if c.EmitAverages, err = envBool("EMIT_AVERAGES", c.EmitAverages); err != nil {
+		return c, err
+	}
+	if c.RefreshInterval, err = envDuration("REFRESH_INTERVAL", c.RefreshInterval); err != nil {
+		return c, err
+	}
+	if c.MinRefreshInterval, err = envDuration("MIN_REFRESH_INTERVAL", c.MinRefreshInterval); err != nil {
+		return c, err
+	}
+	if c.LivenessTimeout, err = envDuration("LIVENESS_TIMEOUT", c.LivenessTimeout); err != nil {
+		return c, err
+	}
+	if c.StaleAfter, err = envDuration("STALE_AFTER", c.StaleAfter); err != nil {
+		return c, err
+	}
+	if c.ReadyMaxAge, err = envDuration("READY_MAX_AGE", c.ReadyMaxAge); err != nil {
+		return c, err
+	}
+	if c.RefreshInterval <= 0 {
+		return c, fmt.Errorf("REFRESH_INTERVAL must be positive")
+	}
+	return c, nil
+}
+
+// secretFieldRe catches credential fields someone forgot to tag.
+var secretFieldRe = regexp.MustCompile(`(?i)token|password|secret|auth|credential|key`)
+
+// redactedValue replaces a credential in marshalled config.
+type redactedValue struct {
+	Value string `json:"value"`
+	Set   bool   `json:"set"`
+}
+
+func (c config) MarshalJSON() ([]byte, error) {
+	out := map[string]any{}
+	v := reflect.ValueOf(c)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, val := t.Field(i), v.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		switch {
+		case f.Tag.Get("secret") == "true" || secretFieldRe.MatchString(f.Name):
+			out[f.Name] = redactedValue{Value: "<redacted>", Set: !val.IsZero()}
+		case f.Type == reflect.TypeOf(time.Duration(0)):
+			out[f.Name] = val.Interface().(time.Duration).String()
+		default:
+			out[f.Name] = val.Interface()
+		}
+	}
+	return json.Marshal(out)
+}
+
+// parseCollectors understands a comma separated list of collector names.
+// "all" enables every collector and "-name" disables one, so both
+// "balances,monthly" and "all,-payee" work. Empty means "all".
+func parseCollectors(v string) (map[string]bool, error) {
+	enabled := map[string]bool{}
+	for _, c := range collectors {
+		enabled[c.name] = false
+	}
+	if strings.TrimSpace(v) == "" {
+		v = "all"
+	}
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		name, disable := strings.CutPrefix(item, "-")
+		switch {
+		case name == "all":
+			for n := range enabled {
+				enabled[n] = !disable
+			}
+		case name == "":
+		default:
+			if _, ok := enabled[name]; !ok {
+				return nil, fmt.Errorf("COLLECTORS: unknown collector %q", name)
+			}
+			enabled[name] = !disable
+		}
+	}
+	return enabled, nil
+}
+
+// parseHeaders reads "Name=value" pairs separated by commas, the format
+// of OTEL_EXPORTER_OTLP_HEADERS.
+func parseHeaders(v string) (map[string]string, error) {
+	var headers map[string]string
+	for _, item := range strings.Split(v, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("expected name=value, got %q", item)
+		}
+		if headers == nil {
+			headers = map[string]string{}
+		}
+		headers[name] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+func envInt(name string, def int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def, fmt.Errorf("%s: %w", name, err)
+	}
+	return n, nil
+}
+
+func envFloat(name string, def float64) (float64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return def, fmt.Errorf("%s: %w", name, err)
+	}
+	return f, nil
+}
+
+func envBool(name string, def bool) (bool, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return def, fmt.Errorf("%s: %w", name, err)
+	}
+	return b, nil
+}
+
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return def, fmt.Errorf("%s: %w", name, err)
+	}
+	return d, nil
+}
+
+// envList splits a comma separated variable, dropping empty entries.
+func envList(name string) []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv(name), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
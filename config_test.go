@@ -0,0 +1,60 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConfigRedactsSecrets(t *testing.T) {
+	secrets := map[string]string{
+		"GITEA_TOKEN":  "gitea-s3cr3t",
+		"API_TOKEN":    "api-s3cr3t",
+		"OTLP_HEADERS": "Authorization=Bearer otlp-s3cr3t",
+	}
+	for k, v := range secrets {
+		t.Setenv(k, v)
+	}
+	c, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(old config) { cfg = old }(cfg)
+	cfg = c
+
+	logged, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	configHandler(rec, httptest.NewRequest("GET", "/debug/config", nil))
+	for where, out := range map[string]string{"logged": string(logged), "served": rec.Body.String()} {
+		for name, v := range secrets {
+			secret := v[strings.LastIndex(v, " ")+1:]
+			if strings.Contains(out, secret) {
+				t.Errorf("%s config contains %s: %s", where, name, out)
+			}
+		}
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(logged, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"GiteaToken", "APIToken", "OTLPHeaders"} {
+		r, ok := doc[field].(map[string]any)
+		if !ok || r["value"] != "<redacted>" || r["set"] != true {
+			t.Errorf("%s = %v, want it redacted and set", field, doc[field])
+		}
+	}
+}
+
+func TestConfigRedactsUntaggedCredentials(t *testing.T) {
+	// a field added without the secret tag is still caught by its name
+	if !secretFieldRe.MatchString("WebhookPassword") || !secretFieldRe.MatchString("SMTPAuth") {
+		t.Error("secretFieldRe misses credential-looking field names")
+	}
+}
@@ -0,0 +1,70 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"log"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var consistencyError = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "ledger_exporter_consistency_error",
+		Help: "Absolute difference between the sum of a balance family's accounts and its total line, per currency",
+	},
+	[]string{"family", "currency"},
+)
+
+// consistencyCurrencies remembers the currencies last reported per family,
+// so the ones that went away can be deleted after the others were set.
+var (
+	consistencyMu         sync.Mutex
+	consistencyCurrencies = map[string][]string{}
+)
+
+// checkConsistency compares the per-account balances of a family with the
+// total lines of the same reports, as parsed. They come from different
+// lines of the output, so a difference means one of the parsers skipped or
+// misread something. Commodities without a currency code don't get total
+// lines parsed and are left out.
+func checkConsistency(family string, accounts, totals *sampleSet) {
+	sums := map[string]float64{}
+	for _, s := range accounts.samples {
+		// the currency is the last label, after the account
+		sums[s.labels[len(s.labels)-1]] += s.value
+	}
+	for _, s := range totals.samples {
+		if _, ok := sums[s.labels[0]]; !ok {
+			sums[s.labels[0]] = 0
+		}
+	}
+	currencies := make([]string, 0, len(sums))
+	for currency := range sums {
+		if currency != "" {
+			currencies = append(currencies, currency)
+		}
+	}
+	slices.Sort(currencies)
+	// set before deleting, so a scrape in between never misses a family
+	consistencyMu.Lock()
+	defer consistencyMu.Unlock()
+	for _, currency := range currencies {
+		total, _ := totals.get(currency)
+		diff := math.Abs(sums[currency] - total)
+		consistencyError.WithLabelValues(family, currency).Set(diff)
+		if diff > totalTolerance {
+			log.Printf("WARNING: %s accounts sum to %.2f %s but the total line says %.2f; "+
+				"this is most likely a parsing bug worth reporting", family, sums[currency], currency, total)
+		}
+	}
+	for _, currency := range consistencyCurrencies[family] {
+		if !slices.Contains(currencies, currency) {
+			consistencyError.DeleteLabelValues(family, currency)
+		}
+	}
+	consistencyCurrencies[family] = currencies
+}
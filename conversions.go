@@ -0,0 +1,77 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// conversionAccount is where hledger books the two sides of a currency
+// conversion.
+const conversionAccount = "equity:conversion"
+
+var ledgerCurrencyExchanged = newGaugeFamily(
+	prometheus.GaugeOpts{
+		Name: "ledger_currency_exchanged",
+		Help: "Monthly amount converted from one currency to another, in units of the source currency",
+	},
+	[]string{"from", "to", "month"},
+)
+
+// conversionCurrency labels a commodity, keeping unmapped commodities as
+// written since an empty from/to label would be useless.
+func conversionCurrency(p posting) string {
+	if p.currency != "" {
+		return p.currency
+	}
+	return p.commodity
+}
+
+// collectCurrencyExchanges pairs the conversion postings of each
+// transaction. Money leaving an asset in the source currency shows up as a
+// positive conversion posting, the target currency as a negative one.
+func collectCurrencyExchanges() error {
+	log.Println("collectCurrencyExchanges called")
+	postings, err := runPrint("conversions", conversionAccount)
+	if err != nil {
+		return err
+	}
+
+	exchanged := newSampleSet()
+	for _, txn := range byTransaction(postings) {
+		sums := map[string]float64{}
+		for _, p := range txn {
+			if p.account == conversionAccount || strings.HasPrefix(p.account, conversionAccount+":") {
+				sums[conversionCurrency(p)] += p.amount
+			}
+		}
+		if len(sums) < 2 {
+			continue
+		}
+		if len(sums) > 2 {
+			log.Printf("skipping conversion on %s (%s) involving %d commodities", txn[0].date.Format("2006-01-02"), txn[0].description, len(sums))
+			continue
+		}
+
+		currencies := make([]string, 0, 2)
+		for c := range sums {
+			currencies = append(currencies, c)
+		}
+		sort.Strings(currencies)
+		from, to := currencies[0], currencies[1]
+		if sums[from] < 0 {
+			from, to = to, from
+		}
+		if sums[from] <= 0 || sums[to] >= 0 {
+			log.Printf("skipping conversion on %s (%s) without opposite signs", txn[0].date.Format("2006-01-02"), txn[0].description)
+			continue
+		}
+		exchanged.add(sums[from], from, to, txn[0].month())
+	}
+	ledgerCurrencyExchanged.publish(exchanged)
+	return nil
+}
@@ -0,0 +1,43 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"math"
+	"slices"
+)
+
+// currencyAllowed applies CURRENCIES and EXCLUDE_CURRENCIES to a currency
+// label, i.e. after commodity symbols are mapped to codes. Commodities
+// without a code have an empty currency label in most metrics.
+func currencyAllowed(currency string) bool {
+	if len(cfg.Currencies) > 0 && !slices.Contains(cfg.Currencies, currency) {
+		return false
+	}
+	return !slices.Contains(cfg.ExcludeCurrencies, currency)
+}
+
+// filterCurrencies drops the samples of set whose currency is filtered and
+// sets ledger_exporter_filtered_amount of f to their absolute sum per
+// currency. Currencies nothing was dropped of this time lose their series.
+func (f *gaugeFamily) filterCurrencies(set *sampleSet) *sampleSet {
+	dropped := map[string]float64{}
+	for _, s := range set.samples {
+		if currency := s.labels[f.currency]; !currencyAllowed(currency) {
+			dropped[currency] += math.Abs(s.value)
+		}
+	}
+	for currency := range f.filtered {
+		if _, ok := dropped[currency]; !ok {
+			filteredAmount.DeleteLabelValues(f.name, currency)
+		}
+	}
+	for currency, amount := range dropped {
+		filteredAmount.WithLabelValues(f.name, currency).Set(amount)
+	}
+	f.filtered = dropped
+	if len(dropped) == 0 {
+		return set
+	}
+	return set.filter(func(lvs []string) bool { return currencyAllowed(lvs[f.currency]) })
+}
@@ -0,0 +1,51 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestFilteredAmount(t *testing.T) {
+	defer func(excluded []string) { cfg.ExcludeCurrencies = excluded }(cfg.ExcludeCurrencies)
+	cfg.ExcludeCurrencies = []string{"GBP", "CHF"}
+	f := newGaugeFamily(prometheus.GaugeOpts{Name: "test_filtered", Help: "test"}, []string{"category", "currency"})
+	filtered := func(currency string) float64 {
+		var m dto.Metric
+		if err := filteredAmount.WithLabelValues(f.name, currency).Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		return m.GetGauge().GetValue()
+	}
+
+	set := newSampleSet()
+	set.set(-12, "books", "GBP")
+	set.set(30, "food", "GBP")
+	set.set(5, "food", "CHF")
+	set.set(40, "food", "EUR")
+	f.publish(set)
+	if _, ok := published(f, "food", "GBP"); ok {
+		t.Error("GBP was published")
+	}
+	if _, ok := published(f, "food", "EUR"); !ok {
+		t.Error("EUR was dropped")
+	}
+	if got := filtered("GBP"); got != 42 {
+		t.Errorf("filtered GBP = %v, want 42", got)
+	}
+
+	// a gauge, so it doesn't grow with every refresh, and the series of a
+	// currency nothing was dropped of goes away
+	set = newSampleSet()
+	set.set(30, "food", "GBP")
+	f.publish(set)
+	if got := filtered("GBP"); got != 30 {
+		t.Errorf("filtered GBP after the next refresh = %v, want 30", got)
+	}
+	if filteredAmount.DeleteLabelValues(f.name, "CHF") {
+		t.Error("CHF kept its series after nothing was dropped of it")
+	}
+}
@@ -0,0 +1,127 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Exit codes of -diff.
+const (
+	diffOK             = 0
+	diffSeriesRemoved  = 1
+	diffCollectorsFail = 3
+)
+
+// journalFile is the journal runHledger reads. Only -diff points it
+// somewhere else.
+var journalFile = ledgerPath
+
+// metricValues maps metric name to label set to value.
+type metricValues map[string]map[string]float64
+
+// collectJournal runs every active collector against path and returns
+// everything they published.
+func collectJournal(w io.Writer, path string) (metricValues, bool) {
+	journalFile = path
+	ok := true
+	values := metricValues{}
+	for _, c := range collectors {
+		if !c.isActive() {
+			continue
+		}
+		if err := c.collect(); err != nil {
+			fmt.Fprintf(w, "%s: collector %s failed: %v\n", path, c.name, err)
+			ok = false
+		}
+		for _, f := range c.families {
+			series := map[string]float64{}
+			for _, s := range f.snapshot() {
+				pairs := make([]string, len(f.labels))
+				for i, l := range f.labels {
+					pairs[i] = fmt.Sprintf("%s=%q", l, s.labels[i])
+				}
+				series["{"+strings.Join(pairs, ", ")+"}"] = s.value
+			}
+			values[f.name] = series
+		}
+	}
+	return values, ok
+}
+
+// runDiff collects both journals at the same pinned instant and writes
+// the series that appeared, disappeared or moved by more than threshold,
+// grouped by metric. It returns the process exit code.
+func runDiff(w io.Writer, oldPath, newPath string, threshold float64) int {
+	now := clock()
+	clock = func() time.Time { return now }
+	// don't let the dry run touch remembered state, and don't carry series
+	// of the old journal over to the new one
+	cfg.StateDir = ""
+	cfg.SeriesGraceCycles, cfg.SeriesCapHysteresis = 0, 0
+	if err := os.MkdirAll(sandboxDir, 0700); err != nil {
+		fmt.Fprintln(w, err)
+		return diffCollectorsFail
+	}
+
+	var results [2]metricValues
+	for i, p := range []string{oldPath, newPath} {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			fmt.Fprintln(w, err)
+			return diffCollectorsFail
+		}
+		var ok bool
+		if results[i], ok = collectJournal(w, abs); !ok {
+			return diffCollectorsFail
+		}
+	}
+	before, after := results[0], results[1]
+
+	names := map[string]bool{}
+	for name := range before {
+		names[name] = true
+	}
+	for name := range after {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	code := diffOK
+	for _, name := range sorted {
+		var lines []string
+		for labels, v := range before[name] {
+			nv, ok := after[name][labels]
+			switch {
+			case !ok:
+				lines = append(lines, fmt.Sprintf("  - %s %g", labels, v))
+				code = diffSeriesRemoved
+			case math.Abs(nv-v) > threshold:
+				lines = append(lines, fmt.Sprintf("  ~ %s %g -> %g (%+g)", labels, v, nv, nv-v))
+			}
+		}
+		for labels, v := range after[name] {
+			if _, ok := before[name][labels]; !ok {
+				lines = append(lines, fmt.Sprintf("  + %s %g", labels, v))
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		// order by labels, then removed before changed before added
+		sort.Slice(lines, func(i, j int) bool { return lines[i][4:] < lines[j][4:] })
+		fmt.Fprintf(w, "%s\n%s\n", name, strings.Join(lines, "\n"))
+	}
+	return code
+}
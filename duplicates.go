@@ -0,0 +1,192 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var ledgerDuplicateTransactions = newGaugeFamily(
+	prometheus.GaugeOpts{
+		Name: "ledger_journal_duplicate_transactions",
+		Help: "Transactions that look like a repeat of an earlier one, by month of the repeat",
+	},
+	[]string{"month"},
+)
+
+// notDuplicateRe matches the tag marking a transaction as a genuine repeat.
+var notDuplicateRe = regexp.MustCompile(`(?:^|[\s,])not-duplicate:`)
+
+// dedupedJournal is a copy of journalFile with the duplicates commented
+// out, "" while every transaction counts.
+var dedupedJournal string
+
+// currentJournal is the journal the collectors read.
+func currentJournal() string {
+	if dedupedJournal != "" {
+		return dedupedJournal
+	}
+	return journalFile
+}
+
+// parseDuplicates reads DUPLICATE_TRANSACTIONS: "warn" only reports them,
+// "exclude" also leaves them out of every other metric. Empty or "off"
+// doesn't look for them.
+func parseDuplicates(v string) (string, error) {
+	switch v {
+	case "", "off":
+		return "", nil
+	case "warn", "exclude":
+		return v, nil
+	}
+	return "", fmt.Errorf("expected off, warn or exclude, got %q", v)
+}
+
+// duplicate is a transaction repeating an earlier one.
+type duplicate struct {
+	txn, of []posting
+}
+
+// duplicateKey is what two transactions must share to be duplicates
+// besides a close enough date: the payee and every posting.
+func duplicateKey(txn []posting) string {
+	parts := make([]string, 0, len(txn))
+	for _, p := range txn {
+		parts = append(parts, fmt.Sprintf("%s\x00%s\x00%.4f", p.account, p.commodity, p.amount))
+	}
+	slices.Sort(parts)
+	return normalizePayee(txn[0].description) + "\xff" + strings.Join(parts, "\xff")
+}
+
+// findDuplicates pairs every transaction with the earliest unpaired one
+// of the same key at most window days before it. A transaction imported
+// twice is one duplicate, but so is a coffee genuinely bought twice a day
+// unless one of them is tagged not-duplicate:.
+func findDuplicates(txns [][]posting, window int) []duplicate {
+	sorted := slices.Clone(txns)
+	slices.SortStableFunc(sorted, func(a, b []posting) int { return a[0].date.Compare(b[0].date) })
+	type candidate struct {
+		txn    []posting
+		paired bool
+	}
+	earlier := map[string][]*candidate{}
+	var dups []duplicate
+	for _, txn := range sorted {
+		if notDuplicateRe.MatchString(txn[0].comment) {
+			continue
+		}
+		k := duplicateKey(txn)
+		i := slices.IndexFunc(earlier[k], func(c *candidate) bool {
+			return !c.paired && txn[0].date.Sub(c.txn[0].date) <= time.Duration(window)*24*time.Hour
+		})
+		if i < 0 {
+			earlier[k] = append(earlier[k], &candidate{txn: txn})
+			continue
+		}
+		earlier[k][i].paired = true
+		dups = append(dups, duplicate{txn: txn, of: earlier[k][i].txn})
+	}
+	return dups
+}
+
+// collectDuplicates looks for duplicate transactions in the journal and,
+// with DUPLICATE_TRANSACTIONS=exclude, points the other collectors at a
+// copy without them. The journal itself is never touched.
+func collectDuplicates() error {
+	log.Println("collectDuplicates called")
+	dedupedJournal = ""
+	postings, err := runPrintOn(journalFile, "duplicates", nil)
+	if err != nil {
+		return err
+	}
+	txns := byTransaction(postings)
+	dups := findDuplicates(txns, cfg.DuplicateWindowDays)
+	counts := newSampleSet()
+	excluded := map[int]bool{}
+	for _, d := range dups {
+		first, dup := d.of[0], d.txn[0]
+		log.Printf("WARNING: transaction %s (%s %q) looks like a duplicate of transaction %s (%s)",
+			dup.txn, dup.date.Format("2006-01-02"), dup.description, first.txn, first.date.Format("2006-01-02"))
+		counts.add(1, dup.month())
+		if n, err := strconv.Atoi(dup.txn); err == nil {
+			excluded[n] = true
+		}
+	}
+	ledgerDuplicateTransactions.publish(counts)
+
+	if cfg.Duplicates != "exclude" || len(excluded) == 0 {
+		return nil
+	}
+	last := 0
+	for _, txn := range txns {
+		n, _ := strconv.Atoi(txn[0].txn)
+		last = max(last, n)
+	}
+	path, err := writeDeduped(journalFile, excluded, last)
+	if err != nil {
+		return fmt.Errorf("excluding duplicates, the metrics include them: %w", err)
+	}
+	dedupedJournal = path
+	return nil
+}
+
+// writeDeduped copies the journal at src into the sandbox with the
+// transactions numbered in excluded commented out. hledger numbers
+// transactions in the order it reads them, which is the order of the
+// file as long as nothing is included; the copy is only written when the
+// file holds exactly the last transactions hledger counted.
+func writeDeduped(src string, excluded map[int]bool, last int) (string, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var out strings.Builder
+	n := 0
+	inTxn, skipping, inComment := false, false, false
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		trimmed := strings.TrimSpace(line)
+		indented := line != "" && (line[0] == ' ' || line[0] == '\t')
+		switch {
+		case inComment:
+			inComment = trimmed != "end comment"
+		case indented && inTxn:
+		case trimmed == "comment":
+			inComment, inTxn = true, false
+		case includeRe.MatchString(line):
+			return "", fmt.Errorf("the journal includes other files")
+		case line != "" && line[0] >= '0' && line[0] <= '9':
+			n++
+			inTxn, skipping = true, excluded[n]
+		default:
+			inTxn = false
+		}
+		if inTxn && skipping {
+			out.WriteString("; duplicate: ")
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	if err := sc.Err(); err != nil {
+		return "", err
+	}
+	if n != last {
+		return "", fmt.Errorf("found %d transactions in the journal, hledger counted %d", n, last)
+	}
+	path := filepath.Join(sandboxDir, "deduped.journal")
+	return path, writeFileAtomic(path, []byte(out.String()))
+}
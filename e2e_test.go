@@ -0,0 +1,113 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+
+//go:build e2e
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// TestEndToEnd runs the exporter against testdata/e2e/sample.journal
+// served by a fake Gitea and checks what /metrics returns the way a
+// Prometheus server reads it. It needs hledger on the PATH:
+//
+//	go test -tags e2e -run TestEndToEnd
+func TestEndToEnd(t *testing.T) {
+	if _, err := exec.LookPath("hledger"); err != nil {
+		t.Skip("hledger not installed")
+	}
+	journal, err := os.ReadFile("testdata/e2e/sample.journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gitea := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token e2e" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/household/books/raw/branch/main/main.journal":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write(journal)
+		case "/api/v1/repos/household/books/commits":
+			var c giteaCommit
+			c.SHA = "0123456789abcdef0123456789abcdef01234567"
+			c.Commit.Message = "May\n"
+			c.Commit.Author.Name = "household"
+			c.Commit.Author.Date = time.Date(2025, 5, 31, 18, 0, 0, 0, time.UTC)
+			json.NewEncoder(w).Encode([]giteaCommit{c})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer gitea.Close()
+
+	t.Setenv("GITEA_TOKEN", "e2e")
+	t.Setenv("GITEA_JOURNAL_URL", gitea.URL+"/household/books/raw/branch/main/main.journal")
+	// the books close with May, which also pins the clock
+	t.Setenv("REPORT_END", "2025-06-01")
+	t.Setenv("RETAIN_MONTHS", "3")
+	c, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(previous func() time.Time) { clock = previous }(clock)
+	pinClock(c.ReportEnd)
+	defer setSandboxDir(sandboxDir)
+	setSandboxDir(t.TempDir())
+
+	srv, err := NewServer(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !srv.Refresh() {
+		t.Fatal("refresh failed")
+	}
+
+	exporter := httptest.NewServer(srv)
+	defer exporter.Close()
+	resp, err := http.Get(exporter.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /metrics: %s", resp.Status)
+	}
+	var parser expfmt.TextParser
+	parsed, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		t.Fatalf("parsing /metrics: %v", err)
+	}
+
+	for _, name := range []string{"ledger_total_assets", "ledger_total_expenses", "ledger_expenses_monthly", "ledger_exporter_journal_commit_info"} {
+		if len(parsed[name].GetMetric()) == 0 {
+			t.Errorf("%s has no series", name)
+		}
+	}
+	for _, m := range parsed["ledger_expenses_monthly"].GetMetric() {
+		if month := labelValue(m, "month"); month < "2025-03" {
+			t.Errorf("ledger_expenses_monthly has month %s outside RETAIN_MONTHS=3", month)
+		}
+	}
+
+	families := make([]*dto.MetricFamily, 0, len(parsed))
+	for _, mf := range parsed {
+		families = append(families, mf)
+	}
+	for _, err := range checkInvariants(families, clock()) {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,84 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var expositionBytes = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "ledger_exporter_exposition_bytes",
+		Help: "Size of the last /metrics response, uncompressed and as sent gzipped",
+	},
+	[]string{"compressed"},
+)
+
+// acceptsGzip reports whether the request's Accept-Encoding allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !ok {
+			return true
+		}
+		weight, err := strconv.ParseFloat(q, 64)
+		return err == nil && weight > 0
+	}
+	return false
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// measuredResponse sends the body through body instead of straight to
+// the connection.
+type measuredResponse struct {
+	http.ResponseWriter
+	body *countingWriter
+}
+
+func (m measuredResponse) Write(p []byte) (int, error) {
+	return m.body.Write(p)
+}
+
+// compressMetrics gzips /metrics for scrapers asking for it and records
+// the payload size before and after. It replaces promhttp's own
+// compression, which only ever sees the compressed size.
+func compressMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			raw := &countingWriter{w: w}
+			next.ServeHTTP(measuredResponse{w, raw}, r)
+			expositionBytes.WithLabelValues("false").Set(float64(raw.n))
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		sent := &countingWriter{w: w}
+		zw := gzip.NewWriter(sent)
+		raw := &countingWriter{w: zw}
+		next.ServeHTTP(measuredResponse{w, raw}, r)
+		zw.Close()
+		expositionBytes.WithLabelValues("false").Set(float64(raw.n))
+		expositionBytes.WithLabelValues("true").Set(float64(sent.n))
+	})
+}
@@ -0,0 +1,161 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// extraFlags are the hledger options EXTRA_ARGS_* may add, and whether
+// they take a value. They only narrow down or rewrite what the reports
+// see; nothing here reads other files or changes the output format the
+// collectors parse.
+var extraFlags = map[string]bool{
+	"--auto": false, "--real": false, "-R": false, "--empty": false, "-E": false,
+	"--pending": false, "-P": false, "--cleared": false, "-C": false, "--unmarked": false, "-U": false,
+	"--cost": false, "-B": false, "--infer-equity": false, "--infer-costs": false, "--date2": false,
+	"--pivot": true, "--alias": true,
+	"--begin": true, "-b": true, "--end": true, "-e": true, "--period": true, "-p": true,
+}
+
+// forbiddenExtraFlags get a clearer error than "not allowed".
+var forbiddenExtraFlags = map[string]string{
+	"-f":              "reads another journal",
+	"--file":          "reads another journal",
+	"-o":              "writes a file",
+	"--output-file":   "writes a file",
+	"--rules-file":    "reads another rules file",
+	"-O":              "changes the output the collectors parse",
+	"--output-format": "changes the output the collectors parse",
+}
+
+// parseExtraArgs reads EXTRA_ARGS_<COLLECTOR> for every collector, e.g.
+// EXTRA_ARGS_BALANCES="--auto --alias expenses:food=expenses:groceries".
+// Values are split at whitespace, so an --alias can't contain spaces.
+func parseExtraArgs(c config) (map[string][]string, error) {
+	extra := map[string][]string{}
+	for _, col := range collectors {
+		name := "EXTRA_ARGS_" + strings.ToUpper(col.name)
+		args := strings.Fields(os.Getenv(name))
+		if len(args) == 0 {
+			continue
+		}
+		if err := checkExtraArgs(c, col.name, args); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		extra[col.name] = args
+	}
+	return extra, nil
+}
+
+// checkExtraArgs validates the extra arguments of one collector against
+// extraFlags and against what the collector and the rest of the
+// configuration already rely on.
+func checkExtraArgs(c config, collector string, args []string) error {
+	var flags []string
+	for i := 0; i < len(args); i++ {
+		flag, value, hasValue := strings.Cut(args[i], "=")
+		if reason, ok := forbiddenExtraFlags[flag]; ok {
+			return fmt.Errorf("%s is not allowed, it %s", flag, reason)
+		}
+		takesValue, ok := extraFlags[flag]
+		if !ok {
+			return fmt.Errorf("%q is not an allowed hledger option", args[i])
+		}
+		if takesValue && !hasValue {
+			if i+1 == len(args) {
+				return fmt.Errorf("%s needs a value", flag)
+			}
+			i++
+			value, hasValue = args[i], true
+		}
+		if hasValue && !takesValue {
+			return fmt.Errorf("%s doesn't take a value", flag)
+		}
+		if takesValue && checkQueryTerm(value) != nil {
+			return fmt.Errorf("%s has no valid value: %q", flag, value)
+		}
+		if flag == "--alias" && !strings.Contains(value, "=") {
+			return fmt.Errorf("--alias needs OLD=NEW, got %q", value)
+		}
+		flags = append(flags, flag)
+	}
+
+	has := func(names ...string) bool {
+		return slices.ContainsFunc(flags, func(f string) bool { return slices.Contains(names, f) })
+	}
+	switch {
+	case has("--pivot") && collector != "balances" && collector != "monthly":
+		return fmt.Errorf("--pivot renames accounts, which the %s collector sorts postings by", collector)
+	case has("--pivot") && c.MemberDimension.Tag != "":
+		return fmt.Errorf("--pivot renames accounts, which MEMBER_DIMENSION=%s matches tags by", c.MemberDimension.Tag)
+	case has("--begin", "-b", "--end", "-e", "--period", "-p") && (collector == "mtd" || collector == "weekly"):
+		return fmt.Errorf("the %s collector picks its own dates", collector)
+	case has("--end", "-e", "--period", "-p") && !c.ReportEnd.IsZero():
+		return fmt.Errorf("REPORT_END already ends the reports")
+	case has("--cost", "-B") && c.Valuation != "" && (collector == "balances" || collector == "monthly" || collector == "payee" || collector == "funding" ||
+		collector == "uncategorized" || collector == "mtd" || collector == "weekly"):
+		return fmt.Errorf("--cost contradicts VALUATION=%s", c.Valuation)
+	}
+	return nil
+}
+
+// withExtraArgs adds the collector's EXTRA_ARGS_* to an hledger argument
+// list, ahead of any "--" so they are read as options.
+func withExtraArgs(collector string, args []string) []string {
+	extra := cfg.ExtraArgs[collector]
+	if len(extra) == 0 {
+		return args
+	}
+	i := slices.Index(args, "--")
+	if i < 0 {
+		i = len(args)
+	}
+	return slices.Concat(args[:i], extra, args[i:])
+}
+
+// isExtraFlag reports whether checkHledgerArgs should let an option
+// through because EXTRA_ARGS_* may contain it.
+func isExtraFlag(arg string) bool {
+	flag, _, _ := strings.Cut(arg, "=")
+	_, ok := extraFlags[flag]
+	return ok
+}
+
+// hledgerArgv remembers the argument lists each collector ran hledger
+// with during its last run, for /debug/config.
+var hledgerArgv = struct {
+	sync.Mutex
+	byCollector map[string][][]string
+}{byCollector: map[string][][]string{}}
+
+func forgetArgv(collector string) {
+	hledgerArgv.Lock()
+	defer hledgerArgv.Unlock()
+	delete(hledgerArgv.byCollector, collector)
+}
+
+func rememberArgv(collector string, args []string) {
+	hledgerArgv.Lock()
+	defer hledgerArgv.Unlock()
+	for _, a := range hledgerArgv.byCollector[collector] {
+		if slices.Equal(a, args) {
+			return
+		}
+	}
+	hledgerArgv.byCollector[collector] = append(hledgerArgv.byCollector[collector], slices.Clone(args))
+}
+
+func argvSnapshot() map[string][][]string {
+	hledgerArgv.Lock()
+	defer hledgerArgv.Unlock()
+	out := make(map[string][][]string, len(hledgerArgv.byCollector))
+	for k, v := range hledgerArgv.byCollector {
+		out[k] = slices.Clone(v)
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"log"
+	"math"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// unattributedFunding labels expenses whose transaction has no asset or
+// liability posting to pay for them, e.g. paid straight out of income.
+const unattributedFunding = "unattributed"
+
+var ledgerExpenseFunding = newGaugeFamily(
+	prometheus.GaugeOpts{
+		Name: "ledger_expense_funding",
+		Help: "Monthly expenses per category and the asset or liability account that paid for them",
+	},
+	[]string{"category", "funding_account", "currency", "month"},
+)
+
+func isFundingAccount(account string) bool {
+	_, asset := familyCategory("assets", account)
+	_, liability := familyCategory("liabilities", account)
+	return asset || liability
+}
+
+// splitCents splits amount over weights, rounding every share to the cent
+// and giving the rounding remainder to the last share so the shares add up
+// to amount.
+func splitCents(amount float64, weights []float64) []float64 {
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+	shares := make([]float64, len(weights))
+	rest := amount
+	for i, w := range weights[:len(weights)-1] {
+		shares[i] = math.Round(amount*w/total*100) / 100
+		rest -= shares[i]
+	}
+	shares[len(shares)-1] = rest
+	return shares
+}
+
+// collectExpenseFunding attributes every expense posting to the asset and
+// liability postings of its transaction, in proportion to how much each
+// of them paid in the posting's currency. Paying accounts are those moving
+// the opposite way of the expenses, so a refund flows back to the account
+// receiving it. Transfers without an expense posting don't match the query.
+// Amounts are valued like ledger_expenses_monthly, so the funding of a
+// category and month adds up to it.
+func collectExpenseFunding() error {
+	log.Println("collectExpenseFunding called")
+	postings, err := runValuedPrint("funding", familyQuery("expenses")...)
+	if err != nil {
+		return err
+	}
+
+	funding := newSampleSet()
+	for _, txn := range byTransaction(postings) {
+		net := map[string]float64{}
+		for _, p := range txn {
+			if _, ok := familyCategory("expenses", p.account); ok {
+				net[p.currency] += p.amount
+			}
+		}
+		for _, p := range txn {
+			category, ok := familyCategory("expenses", p.account)
+			if !ok || p.amount == 0 {
+				continue
+			}
+			var accounts []string
+			var weights []float64
+			for _, f := range txn {
+				if f.currency != p.currency || !isFundingAccount(f.account) {
+					continue
+				}
+				if (net[p.currency] > 0) != (f.amount < 0) || f.amount == 0 {
+					continue
+				}
+				accounts = append(accounts, f.account)
+				weights = append(weights, math.Abs(f.amount))
+			}
+			if len(accounts) == 0 {
+				funding.add(p.amount, category, unattributedFunding, p.currency, p.month())
+				continue
+			}
+			for i, share := range splitCents(p.amount, weights) {
+				funding.add(share, category, accounts[i], p.currency, p.month())
+			}
+		}
+	}
+	ledgerExpenseFunding.publish(funding)
+	return nil
+}
@@ -0,0 +1,70 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// fundingPrint is what hledger print shows for the March expenses valued
+// in $: groceries paid from three accounts, which doesn't split evenly
+// into cents, and a book paid from one.
+const fundingPrint = `"txnidx","date","date2","status","code","description","comment","account","amount","commodity","credit","debit","posting-status","posting-comment"
+"1","2024-03-02","","","","Supermarket","","expenses:food","10.00","$","","10.00","",""
+"1","2024-03-02","","","","Supermarket","","assets:bank","-3.00","$","3.00","","",""
+"1","2024-03-02","","","","Supermarket","","assets:cash","-3.00","$","3.00","","",""
+"1","2024-03-02","","","","Supermarket","","liabilities:visa","-4.00","$","4.00","","",""
+"2","2024-03-09","","","","Bookshop","","expenses:books","12.35","$","","12.35","",""
+"2","2024-03-09","","","","Bookshop","","assets:bank","-12.35","$","12.35","","",""
+"3","2024-03-20","","","","Bakery","","expenses:food","0.07","$","","0.07","",""
+"3","2024-03-20","","","","Bakery","","assets:bank","-0.03","$","0.03","","",""
+"3","2024-03-20","","","","Bakery","","assets:cash","-0.04","$","0.04","","",""
+`
+
+// fundingReg is the monthly register of the same postings.
+const fundingReg = `"txnidx","date","code","description","account","amount","total"
+"0","2024-03-01","","","expenses:books","$12.35","$12.35"
+"0","2024-03-01","","","expenses:food","$10.07","$22.42"
+`
+
+func TestFundingAddsUpToMonthly(t *testing.T) {
+	setValuation(t, "end", false)
+	defer func(exec func(...string) ([]byte, []byte, error)) { hledgerExec = exec }(hledgerExec)
+	hledgerExec = func(args ...string) ([]byte, []byte, error) {
+		opts := args[:slices.Index(args, "--")]
+		if !slices.Contains(opts, "--value") {
+			t.Errorf("%q isn't valued like the monthly report", args)
+		}
+		if slices.Contains(opts, "print") {
+			return []byte(fundingPrint), nil, nil
+		}
+		return []byte(fundingReg), nil, nil
+	}
+	if err := collectExpenseFunding(); err != nil {
+		t.Fatal(err)
+	}
+	if err := collectMonthlyExpenses(); err != nil {
+		t.Fatal(err)
+	}
+
+	type key struct{ category, month string }
+	funded := map[key]float64{}
+	for _, s := range ledgerExpenseFunding.snapshot() {
+		if got := math.Round(s.value*100) / 100; math.Abs(s.value-got) > 1e-9 {
+			t.Errorf("%q = %v isn't whole cents", s.labels, s.value)
+		}
+		funded[key{s.labels[0], s.labels[3]}] += s.value
+	}
+	monthly := ledgerExpensesMonthly.snapshot()
+	if len(monthly) == 0 {
+		t.Fatal("no monthly expenses")
+	}
+	for _, s := range monthly {
+		k := key{s.labels[0], s.labels[2]}
+		if math.Abs(funded[k]-s.value) > 0.005 {
+			t.Errorf("funding of %v adds up to %.4f, ledger_expenses_monthly is %.2f", k, funded[k], s.value)
+		}
+	}
+}
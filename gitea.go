@@ -0,0 +1,183 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	journalCommitInfoDesc = prometheus.NewDesc(
+		"ledger_exporter_journal_commit_info",
+		"Latest Gitea commit touching the journal, value is always 1",
+		[]string{"sha", "author", "message_first_line"}, nil,
+	)
+	journalCommitTimestampDesc = prometheus.NewDesc(
+		"ledger_exporter_journal_commit_timestamp_seconds",
+		"Author timestamp of the latest Gitea commit touching the journal",
+		nil, nil,
+	)
+)
+
+// commitMetrics exports the latest journal commit. Both metrics disappear
+// together when the commit API isn't reachable, and a refresh replaces
+// them in one step, so no scrape sees them half updated or missing.
+type commitMetrics struct {
+	mu     sync.Mutex
+	latest *giteaCommit
+}
+
+var journalCommit = &commitMetrics{}
+
+func (m *commitMetrics) set(c *giteaCommit) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latest = c
+}
+
+func (m *commitMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- journalCommitInfoDesc
+	ch <- journalCommitTimestampDesc
+}
+
+func (m *commitMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.mu.Lock()
+	c := m.latest
+	m.mu.Unlock()
+	if c == nil {
+		return
+	}
+	firstLine, _, _ := strings.Cut(strings.TrimSpace(c.Commit.Message), "\n")
+	ch <- prometheus.MustNewConstMetric(journalCommitInfoDesc, prometheus.GaugeValue, 1,
+		c.SHA, c.Commit.Author.Name, strings.TrimSpace(firstLine))
+	ch <- prometheus.MustNewConstMetric(journalCommitTimestampDesc, prometheus.GaugeValue,
+		float64(c.Commit.Author.Date.Unix()))
+}
+
+// giteaFile identifies a file inside a Gitea repository at a given ref.
+type giteaFile struct {
+	apiBase string // e.g. https://git.example.com/api/v1
+	owner   string
+	repo    string
+	ref     string
+	path    string
+}
+
+// parseGiteaRawURL understands the two raw URL shapes Gitea hands out:
+//
+//	https://host/{owner}/{repo}/raw/{branch|tag|commit}/{ref}/{path}
+//	https://host/api/v1/repos/{owner}/{repo}/raw/{path}?ref={ref}
+func parseGiteaRawURL(raw string) (giteaFile, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return giteaFile{}, err
+	}
+	segs := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i, s := range segs {
+		if s != "raw" || i < 2 {
+			continue
+		}
+		f := giteaFile{owner: segs[i-2], repo: segs[i-1]}
+		prefix := segs[:i-2]
+		rest := segs[i+1:]
+		if len(prefix) >= 3 && strings.Join(prefix[len(prefix)-3:], "/") == "api/v1/repos" {
+			prefix = prefix[:len(prefix)-3]
+			f.ref = u.Query().Get("ref")
+		} else {
+			if len(rest) < 3 {
+				break
+			}
+			switch rest[0] {
+			case "branch", "tag", "commit":
+			default:
+				return giteaFile{}, fmt.Errorf("unsupported raw url kind %q", rest[0])
+			}
+			f.ref, rest = rest[1], rest[2:]
+		}
+		f.path = strings.Join(rest, "/")
+		base := *u
+		base.Path = "/" + strings.Join(append(prefix, "api", "v1"), "/")
+		base.RawPath, base.RawQuery, base.Fragment = "", "", ""
+		f.apiBase = strings.TrimSuffix(base.String(), "/")
+		return f, nil
+	}
+	return giteaFile{}, fmt.Errorf("%q is not a Gitea raw file url", raw)
+}
+
+type giteaCommit struct {
+	SHA    string `json:"sha"`
+	Commit struct {
+		Message string `json:"message"`
+		Author  struct {
+			Name string    `json:"name"`
+			Date time.Time `json:"date"`
+		} `json:"author"`
+	} `json:"commit"`
+}
+
+// fetchLatestCommit asks the Gitea API for the newest commit touching f.path.
+func fetchLatestCommit(token string, f giteaFile) (*giteaCommit, error) {
+	q := url.Values{}
+	q.Set("path", f.path)
+	q.Set("limit", "1")
+	q.Set("stat", "false")
+	q.Set("verification", "false")
+	q.Set("files", "false")
+	if f.ref != "" {
+		q.Set("sha", f.ref)
+	}
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/commits?%s",
+		f.apiBase, url.PathEscape(f.owner), url.PathEscape(f.repo), q.Encode())
+
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/json")
+	resp, err := doOutbound(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("commit api returned %s", resp.Status)
+	}
+
+	var commits []giteaCommit
+	if err := json.NewDecoder(resp.Body).Decode(&commits); err != nil {
+		return nil, fmt.Errorf("decoding commit list: %w", err)
+	}
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("no commits touch %s", f.path)
+	}
+	return &commits[0], nil
+}
+
+// updateJournalCommit refreshes the commit metrics. Tokens without repo
+// read scope get a 403 here even though the raw fetch works, so failures
+// only clear the commit metrics and never fail the refresh.
+func updateJournalCommit(token, rawURL string) {
+	f, err := parseGiteaRawURL(rawURL)
+	if err != nil {
+		log.Printf("skipping journal commit metadata: %v", err)
+		journalCommit.set(nil)
+		return
+	}
+	c, err := fetchLatestCommit(token, f)
+	if err != nil {
+		log.Printf("skipping journal commit metadata: %v", err)
+		journalCommit.set(nil)
+		return
+	}
+	journalCommit.set(c)
+}
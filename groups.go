@@ -0,0 +1,169 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ledgerExpensesGrouped = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_expenses_grouped",
+			Help: "Expenses per category group from CATEGORY_GROUPS_FILE and currency",
+		},
+		[]string{"group", "currency"},
+	)
+
+	ledgerExpensesGroupedMonthly = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_expenses_grouped_monthly",
+			Help: "Monthly expenses per category group from CATEGORY_GROUPS_FILE, currency and month",
+		},
+		[]string{"group", "currency", "month"},
+	)
+)
+
+// categoryGroups maps expense categories onto coarser groups. A pattern
+// matches the category itself and everything below it.
+type categoryGroups struct {
+	patterns     map[string]string // pattern -> group
+	defaultGroup string
+}
+
+// MarshalJSON shows the mapping as group -> categories for /debug/config.
+func (g *categoryGroups) MarshalJSON() ([]byte, error) {
+	groups := map[string][]string{}
+	for p, group := range g.patterns {
+		groups[group] = append(groups[group], p)
+	}
+	for _, ps := range groups {
+		sort.Strings(ps)
+	}
+	return json.Marshal(struct {
+		Groups       map[string][]string `json:"groups"`
+		DefaultGroup string              `json:"default_group"`
+	}{groups, g.defaultGroup})
+}
+
+// loadCategoryGroups reads a mapping file made of lines like
+//
+//	fixed: [rent, insurance, utilities]
+//	fun: [eating-out, hobbies]
+//
+// where categories are expense accounts, with or without the prefix of
+// their ACCOUNT_TYPES entry.
+func loadCategoryGroups(path, defaultGroup string, types []accountType) (*categoryGroups, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	g, err := parseCategoryGroups(f, defaultGroup, types)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return g, nil
+}
+
+func parseCategoryGroups(r io.Reader, defaultGroup string, types []accountType) (*categoryGroups, error) {
+	g := &categoryGroups{patterns: map[string]string{}, defaultGroup: defaultGroup}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		group, list, ok := strings.Cut(line, ":")
+		group = strings.TrimSpace(group)
+		if !ok || group == "" {
+			return nil, fmt.Errorf("line %d: expected \"group: [category, ...]\"", n)
+		}
+		list = strings.TrimSpace(list)
+		list = strings.TrimSuffix(strings.TrimPrefix(list, "["), "]")
+		for _, p := range strings.Split(list, ",") {
+			p = trimFamilyPrefix(types, "expenses", strings.TrimSpace(p))
+			if p == "" {
+				continue
+			}
+			if other, dup := g.patterns[p]; dup {
+				return nil, fmt.Errorf("line %d: %q is already mapped to %q", n, p, other)
+			}
+			g.patterns[p] = group
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return g, g.validate()
+}
+
+// validate rejects patterns nested inside each other, e.g. "food" and
+// "food:eating-out", since which group wins would be a matter of taste.
+func (g *categoryGroups) validate() error {
+	patterns := make([]string, 0, len(g.patterns))
+	for p := range g.patterns {
+		patterns = append(patterns, p)
+	}
+	sort.Strings(patterns)
+	for i := 1; i < len(patterns); i++ {
+		for j := 0; j < i; j++ {
+			if strings.HasPrefix(patterns[i], patterns[j]+":") {
+				return fmt.Errorf("%q (%s) overlaps %q (%s)",
+					patterns[i], g.patterns[patterns[i]], patterns[j], g.patterns[patterns[j]])
+			}
+		}
+	}
+	return nil
+}
+
+// groupFor returns the group category belongs to.
+func (g *categoryGroups) groupFor(category string) string {
+	for c := category; c != ""; {
+		if group, ok := g.patterns[c]; ok {
+			return group
+		}
+		i := strings.LastIndex(c, ":")
+		if i < 0 {
+			break
+		}
+		c = c[:i]
+	}
+	return g.defaultGroup
+}
+
+// publishExpenseGroups sums the per-account expense balances into groups.
+// Balance amounts exclude subaccounts, so the sum equals the total.
+func publishExpenseGroups() {
+	if cfg.CategoryGroups == nil {
+		return
+	}
+	set := newSampleSet()
+	for _, s := range expenseGauge.snapshot() {
+		set.add(s.value, cfg.CategoryGroups.groupFor(s.labels[0]), s.labels[1])
+	}
+	ledgerExpensesGrouped.publish(set)
+}
+
+func publishMonthlyExpenseGroups(parsed monthlyAmounts) {
+	if cfg.CategoryGroups == nil {
+		return
+	}
+	set := newSampleSet()
+	for k, months := range parsed {
+		group := cfg.CategoryGroups.groupFor(k.category)
+		for month, amount := range months {
+			set.add(amount, group, k.currency, month)
+		}
+	}
+	ledgerExpensesGroupedMonthly.publish(set)
+}
@@ -0,0 +1,49 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// heartbeat is bumped by the refresh loop whenever it isn't busy
+	// refreshing, so it only goes stale while a refresh hangs.
+	heartbeat atomic.Int64
+	// lastSuccess is when the last refresh completed without errors.
+	lastSuccess atomic.Int64
+	// loopFailure holds the reason the refresh loop died, if it did.
+	loopFailure atomic.Value
+)
+
+// livezHandler fails once the refresh loop died or has been stuck in a
+// single refresh for longer than cfg.LivenessTimeout.
+func livezHandler(w http.ResponseWriter, r *http.Request) {
+	if reason, ok := loopFailure.Load().(string); ok {
+		http.Error(w, reason, http.StatusServiceUnavailable)
+		return
+	}
+	if age := time.Since(time.Unix(0, heartbeat.Load())); age > cfg.LivenessTimeout {
+		http.Error(w, fmt.Sprintf("refresh loop stuck for %s", age.Round(time.Second)), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// readyzHandler fails while the last successful refresh is older than
+// cfg.ReadyMaxAge, e.g. during a Gitea outage.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	last := lastSuccess.Load()
+	if last == 0 {
+		http.Error(w, "no successful refresh yet", http.StatusServiceUnavailable)
+		return
+	}
+	if age := time.Since(time.Unix(0, last)); age > cfg.ReadyMaxAge {
+		http.Error(w, fmt.Sprintf("last successful refresh %s ago", age.Round(time.Second)), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,154 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Headline values that aren't a metric family of their own.
+const (
+	historyNetWorth        = "net_worth"
+	historyRefreshDuration = "refresh_duration_seconds"
+)
+
+func defaultHistorySeries() []string {
+	return []string{"ledger_total_expenses", "ledger_total_assets", historyNetWorth, historyRefreshDuration}
+}
+
+// parseHistorySeries checks HISTORY_SERIES against the exported families.
+func parseHistorySeries(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return defaultHistorySeries(), nil
+	}
+	for _, name := range names {
+		if name == historyNetWorth || name == historyRefreshDuration || familyByName(name) != nil {
+			continue
+		}
+		return nil, fmt.Errorf("unknown metric %q", name)
+	}
+	return names, nil
+}
+
+func familyByName(name string) *gaugeFamily {
+	for _, c := range collectors {
+		for _, f := range c.families {
+			if f.name == name {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+type historyPoint struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+type historySeries struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Points []historyPoint    `json:"points"`
+	// seen is the refresh that last added a point.
+	seen uint64
+}
+
+// history keeps the last cfg.HistoryLength values of every tracked series.
+// A series that got no point for that many refreshes is dropped, so the
+// memory used is bounded by the series a single refresh can produce.
+var history struct {
+	mu        sync.RWMutex
+	refreshes uint64
+	series    map[string]*historySeries
+}
+
+func (s *historySeries) add(p historyPoint) {
+	if len(s.Points) >= cfg.HistoryLength {
+		n := copy(s.Points, s.Points[len(s.Points)-cfg.HistoryLength+1:])
+		s.Points = s.Points[:n]
+	}
+	s.Points = append(s.Points, p)
+}
+
+// recordHistory adds a point for every tracked series after a refresh.
+func recordHistory(now time.Time, took time.Duration) {
+	type value struct {
+		name   string
+		labels map[string]string
+		value  float64
+	}
+	var values []value
+	for _, name := range cfg.HistorySeries {
+		switch name {
+		case historyRefreshDuration:
+			values = append(values, value{name, nil, took.Seconds()})
+		case historyNetWorth:
+			snapshotMu.RLock()
+			for currency, v := range snapshot.NetWorth {
+				values = append(values, value{name, map[string]string{"currency": currency}, v})
+			}
+			snapshotMu.RUnlock()
+		default:
+			f := familyByName(name)
+			for _, s := range f.snapshot() {
+				labels := map[string]string{}
+				for i, l := range f.labels {
+					labels[l] = s.labels[i]
+				}
+				values = append(values, value{name, labels, s.value})
+			}
+		}
+	}
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+	if history.series == nil {
+		history.series = map[string]*historySeries{}
+	}
+	history.refreshes++
+	for _, v := range values {
+		key := v.name + fmt.Sprint(v.labels)
+		s, ok := history.series[key]
+		if !ok {
+			s = &historySeries{Name: v.name, Labels: v.labels}
+			history.series[key] = s
+		}
+		s.add(historyPoint{Timestamp: now.Unix(), Value: v.value})
+		s.seen = history.refreshes
+	}
+	for key, s := range history.series {
+		if history.refreshes-s.seen >= uint64(cfg.HistoryLength) {
+			delete(history.series, key)
+		}
+	}
+}
+
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	history.mu.RLock()
+	keys := make([]string, 0, len(history.series))
+	for k := range history.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	series := make([]historySeries, 0, len(keys))
+	for _, k := range keys {
+		s := *history.series[k]
+		s.Points = append([]historyPoint(nil), s.Points...)
+		series = append(series, s)
+	}
+	history.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(struct {
+		Series []historySeries `json:"series"`
+	}{series}); err != nil {
+		log.Printf("encoding history: %v", err)
+	}
+}
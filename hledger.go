@@ -0,0 +1,135 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var hledgerFailures = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "ledger_exporter_hledger_failures_total",
+		Help: "Failed hledger runs by collector and classified reason",
+	},
+	[]string{"collector", "reason"},
+)
+
+// hledgerReasons classifies hledger's stderr, first match wins. Assertion
+// failures come first because they also carry a file:line position.
+var hledgerReasons = []struct {
+	reason string
+	re     *regexp.Regexp
+}{
+	{"assertion", regexp.MustCompile(`(?i)balance assertion|assertion failed|failed assertion`)},
+	{"missing_file", regexp.MustCompile(`(?i)does not exist|no such file or directory`)},
+	{"bad_usage", regexp.MustCompile(`(?im)unknown flag|unknown option|unrecognized option|unknown command|invalid argument|requires an argument|^usage:`)},
+	{"parse_error", regexp.MustCompile(`(?i)parse error|unexpected|could not parse|unbalanced|:\d+:\d+`)},
+}
+
+func classifyHledgerError(stderr string) string {
+	for _, r := range hledgerReasons {
+		if r.re.MatchString(stderr) {
+			return r.reason
+		}
+	}
+	return "other"
+}
+
+// hledgerError is a failed hledger run with its classified stderr.
+type hledgerError struct {
+	reason string
+	stderr string
+	err    error
+}
+
+func (e *hledgerError) Error() string {
+	return fmt.Sprintf("hledger failed (%s): %v\n%s", e.reason, e.err, e.stderr)
+}
+
+func (e *hledgerError) Unwrap() error { return e.err }
+
+// hledgerExec runs the hledger binary. It is a variable so a fake can
+// stand in for hledger.
+var hledgerExec = func(args ...string) (stdout, stderr []byte, err error) {
+	cmd := exec.Command("hledger", args...)
+	cmd.Dir = sandboxDir
+	cmd.Env = hledgerEnv()
+	var out, errOut bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errOut
+	err = cmd.Run()
+	return out.Bytes(), errOut.Bytes(), err
+}
+
+// runHledger runs hledger against the journal on behalf of collector and
+// returns its stdout. Failures are counted by reason. Duplicates excluded
+// by DUPLICATE_TRANSACTIONS=exclude are left out.
+func runHledger(collector string, args ...string) ([]byte, error) {
+	return runHledgerOn(currentJournal(), collector, args...)
+}
+
+// hledgerFlags are the only options the exporter ever passes to hledger,
+// besides its own leading -f and the extraFlags of EXTRA_ARGS_*. Anything
+// else that looks like an option ahead of "--" is refused, so a configured
+// value can't smuggle in e.g. another -f or --rules-file.
+var hledgerFlags = map[string]bool{
+	"-s":      true,
+	"--depth": true, "--no-elide": true, "--monthly": true, "--average": true, "--historical": true,
+	"--begin": true, "--end": true, "--layout": true, "--output-format": true,
+	"--value": true, "--infer-market-prices": true, "--cost": true,
+}
+
+// checkHledgerArgs accepts "-f file" as the first two arguments, where
+// runHledgerOn puts it, and nothing but known options after it up to "--".
+func checkHledgerArgs(args []string) error {
+	if len(args) < 2 || args[0] != "-f" {
+		return fmt.Errorf("hledger arguments must start with -f, got %q", args)
+	}
+	for _, a := range args[2:] {
+		if a == "--" {
+			return nil
+		}
+		if strings.HasPrefix(a, "-") && !hledgerFlags[a] && !isExtraFlag(a) {
+			return fmt.Errorf("refusing unexpected hledger option %q", a)
+		}
+	}
+	return nil
+}
+
+// checkQueryTerm rejects configured values that end up as bare hledger
+// arguments but would be read as options.
+func checkQueryTerm(term string) error {
+	if term == "" || strings.HasPrefix(term, "-") {
+		return fmt.Errorf("%q is not a valid hledger query term", term)
+	}
+	return nil
+}
+
+// runHledgerOn is runHledger for any input file hledger can read.
+func runHledgerOn(file, collector string, args ...string) ([]byte, error) {
+	args = append([]string{"-f", file}, withReportEnd(withExtraArgs(collector, args))...)
+	if err := checkHledgerArgs(args); err != nil {
+		hledgerFailures.WithLabelValues(collector, "bad_usage").Inc()
+		return nil, err
+	}
+	rememberArgv(collector, args)
+	stdout, stderr, err := hledgerExec(args...)
+	if err != nil {
+		msg := strings.TrimSpace(string(stderr))
+		reason := classifyHledgerError(msg)
+		hledgerFailures.WithLabelValues(collector, reason).Inc()
+		if reason == "bad_usage" {
+			log.Printf("HINT: hledger rejected the arguments of collector %s (%q); "+
+				"the installed hledger version may be incompatible with this exporter", collector, args)
+		}
+		return nil, &hledgerError{reason: reason, stderr: msg, err: err}
+	}
+	return stdout, nil
+}
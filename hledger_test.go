@@ -0,0 +1,75 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckHledgerArgs(t *testing.T) {
+	cases := []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"-f", "/tmp/main.journal", "bal", "--depth", "5"}, true},
+		{[]string{"-f", "csv:/tmp/0-bank.csv", "import", "print", "--output-format", "journal"}, true},
+		// after "--" it is a query term, which hledger never reads as an option
+		{[]string{"-f", "/tmp/main.journal", "bal", "--", "-f"}, true},
+		{[]string{"bal", "-f", "/etc/passwd"}, false},
+		{[]string{"-f", "/tmp/main.journal", "bal", "-f", "/etc/passwd"}, false},
+		{[]string{"-f", "/tmp/main.journal", "bal", "-f/etc/passwd"}, false},
+		{[]string{"-f", "/tmp/main.journal", "bal", "--file=/etc/passwd"}, false},
+		{[]string{"-f", "/tmp/main.journal", "bal", "-sf", "/etc/passwd"}, false},
+		{[]string{"-f", "/tmp/main.journal", "bal", "--rules-file", "/tmp/evil.rules"}, false},
+		{[]string{"-f"}, false},
+	}
+	for _, tc := range cases {
+		if err := checkHledgerArgs(tc.args); (err == nil) != tc.ok {
+			t.Errorf("checkHledgerArgs(%q) = %v, want ok %v", tc.args, err, tc.ok)
+		}
+	}
+}
+
+func TestExtraArgsInjection(t *testing.T) {
+	for _, v := range []string{
+		"-f /etc/passwd",
+		"-f/etc/passwd",
+		"--file=/etc/passwd",
+		"--file /etc/passwd",
+		"--auto -f /etc/passwd",
+		"--alias -f",
+		"--pivot=-f",
+		"--rules-file /tmp/evil.rules",
+		"-o /tmp/out",
+		"-O json",
+	} {
+		t.Setenv("EXTRA_ARGS_BALANCES", v)
+		if _, err := parseExtraArgs(config{}); err == nil {
+			t.Errorf("EXTRA_ARGS_BALANCES=%q was accepted", v)
+		}
+	}
+}
+
+func TestQueryTermInjection(t *testing.T) {
+	for _, v := range []string{"expenses=-f", "expenses=--file=/etc/passwd", "assets=assets -f"} {
+		if _, err := parseAccountTypes(v); err == nil {
+			t.Errorf("ACCOUNT_TYPES=%q was accepted", v)
+		}
+	}
+}
+
+// Even arguments that got past configuration parsing never reach hledger.
+func TestRunHledgerRefusesInjection(t *testing.T) {
+	defer func(exec func(...string) ([]byte, []byte, error)) { hledgerExec = exec }(hledgerExec)
+	hledgerExec = func(args ...string) ([]byte, []byte, error) {
+		t.Errorf("hledger ran with %q", args)
+		return nil, nil, nil
+	}
+	defer func(extra map[string][]string) { cfg.ExtraArgs = extra }(cfg.ExtraArgs)
+	cfg.ExtraArgs = map[string][]string{"balances": {"-f", "/etc/passwd"}}
+	_, err := runHledger("balances", "bal", "--", "expenses")
+	if err == nil || !strings.Contains(err.Error(), "-f") {
+		t.Errorf("err = %v, want -f refused", err)
+	}
+}
@@ -0,0 +1,179 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ledgerHoldings = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_holdings",
+			Help: "Quantity held per asset account and commodity",
+		},
+		[]string{"account", "commodity"},
+	)
+
+	ledgerHoldingsCost = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_holdings_cost",
+			Help: "Average cost basis of the quantity held per asset account and commodity",
+		},
+		[]string{"account", "commodity", "currency"},
+	)
+)
+
+// jsonAmount is an amount in hledger's JSON output. hledger 1.34 renamed
+// aprice/UnitPrice/TotalPrice to acost/UnitCost/TotalCost, both are read.
+type jsonAmount struct {
+	Commodity string `json:"acommodity"`
+	Quantity  struct {
+		Float float64 `json:"floatingPoint"`
+	} `json:"aquantity"`
+	Cost  *jsonCost `json:"acost"`
+	Price *jsonCost `json:"aprice"`
+}
+
+type jsonCost struct {
+	Tag      string     `json:"tag"`
+	Contents jsonAmount `json:"contents"`
+}
+
+type jsonTransaction struct {
+	Date     string `json:"tdate"`
+	Postings []struct {
+		Account string       `json:"paccount"`
+		Amounts []jsonAmount `json:"pamount"`
+	} `json:"tpostings"`
+}
+
+// totalCost returns the cost of the whole amount and the commodity it is
+// expressed in, or false when the amount carries no @ or @@ annotation.
+func (a jsonAmount) totalCost() (float64, string, bool) {
+	c := a.Cost
+	if c == nil {
+		c = a.Price
+	}
+	if c == nil {
+		return 0, "", false
+	}
+	total := c.Contents.Quantity.Float
+	switch c.Tag {
+	case "UnitCost", "UnitPrice":
+		total *= a.Quantity.Float
+	case "TotalCost", "TotalPrice":
+		// @@ costs are unsigned, follow the quantity
+		if a.Quantity.Float < 0 {
+			total = -total
+		}
+	default:
+		return 0, "", false
+	}
+	if total < 0 {
+		total = -total
+	}
+	return total, c.Contents.Commodity, true
+}
+
+// holdingsCommodity reports whether commodity should be tracked as a
+// holding: the allowlist if one is configured, anything but the known
+// currencies otherwise.
+func holdingsCommodity(commodity string) bool {
+	if len(cfg.HoldingsCommodities) > 0 {
+		for _, c := range cfg.HoldingsCommodities {
+			if c == commodity {
+				return true
+			}
+		}
+		return false
+	}
+	_, isCurrency := map[string]string{"€": "EUR", "$": "USD"}[commodity]
+	return !isCurrency && commodity != "EUR" && commodity != "USD"
+}
+
+type lot struct {
+	quantity float64
+	cost     float64
+	currency string
+}
+
+// collectHoldings walks the asset postings in date order and keeps a
+// running quantity and cost basis per account and commodity. Purchases add
+// their cost; sales and transfers out reduce the cost in proportion to the
+// quantity leaving, i.e. at average cost.
+func collectHoldings() error {
+	log.Println("collectHoldings called")
+	args := append([]string{"print", "--output-format", "json", "--"}, familyQuery("assets")...)
+	out, err := runHledger("holdings", args...)
+	if err != nil {
+		return fmt.Errorf("hledger print: %w", err)
+	}
+	var txns []jsonTransaction
+	if err := json.Unmarshal(out, &txns); err != nil {
+		return fmt.Errorf("decoding print json: %w", err)
+	}
+
+	type key struct{ account, commodity string }
+	lots := map[key]*lot{}
+	var order []key
+	for _, t := range txns {
+		for _, p := range t.Postings {
+			account, ok := familyCategory("assets", p.Account)
+			if !ok {
+				continue
+			}
+			for _, a := range p.Amounts {
+				if !holdingsCommodity(a.Commodity) {
+					continue
+				}
+				k := key{account, a.Commodity}
+				l, ok := lots[k]
+				if !ok {
+					l = &lot{}
+					lots[k] = l
+					order = append(order, k)
+				}
+				q := a.Quantity.Float
+				if q < 0 {
+					if l.quantity > 0 {
+						l.cost -= l.cost * min(-q/l.quantity, 1)
+					}
+					l.quantity += q
+					continue
+				}
+				l.quantity += q
+				if cost, commodity, ok := a.totalCost(); ok {
+					if l.currency != "" && l.currency != commodity {
+						log.Printf("WARNING: %s %s bought in %s and %s on %s, keeping %s as cost currency",
+							k.account, k.commodity, l.currency, commodity, t.Date, l.currency)
+						continue
+					}
+					l.currency = commodity
+					l.cost += cost
+				}
+			}
+		}
+	}
+
+	quantities := newSampleSet()
+	costs := newSampleSet()
+	for _, k := range order {
+		l := lots[k]
+		quantities.set(l.quantity, k.account, k.commodity)
+		if l.currency != "" {
+			currency := map[string]string{"€": "EUR", "$": "USD"}[l.currency]
+			if currency == "" {
+				currency = l.currency
+			}
+			costs.set(l.cost, k.account, k.commodity, currency)
+		}
+	}
+	ledgerHoldings.publish(quantities)
+	ledgerHoldingsCost.publish(costs)
+	return nil
+}
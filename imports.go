@@ -0,0 +1,82 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// csvSource is where a CSV_IMPORTS file and its rules are fetched from.
+// Gitea API urls carry the ref in the query, so the names are worked out
+// from the path alone.
+type csvSource struct {
+	csv, rules string
+	// name is the file name, e.g. bank.csv
+	name string
+}
+
+func parseCSVSource(raw string) (csvSource, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return csvSource{}, err
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return csvSource{}, fmt.Errorf("%q names no file", raw)
+	}
+	rules := *u
+	rules.Path += ".rules"
+	rules.RawPath = ""
+	return csvSource{csv: raw, rules: rules.String(), name: name}, nil
+}
+
+// importCSVs fetches every CSV_IMPORTS file and its rules into a scratch
+// directory and returns them converted to journal entries. hledger picks
+// up foo.csv.rules for foo.csv by itself.
+func importCSVs(token string) ([]byte, error) {
+	log.Println("importCSVs called")
+	dir, err := os.MkdirTemp("", "ledger-import-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	var out bytes.Buffer
+	for i, raw := range cfg.CSVImports {
+		src, err := parseCSVSource(raw)
+		if err != nil {
+			return nil, err
+		}
+		// prefixed so two exports both called statement.csv don't collide
+		name := filepath.Join(dir, fmt.Sprintf("%d-%s", i, src.name))
+		csvData, err := fetchRaw(token, src.csv)
+		if err != nil {
+			return nil, err
+		}
+		rules, err := fetchRaw(token, src.rules)
+		if err != nil {
+			return nil, fmt.Errorf("rules for %s: %w", raw, err)
+		}
+		if err := os.WriteFile(name, csvData, 0600); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(name+".rules", rules, 0600); err != nil {
+			return nil, err
+		}
+		// the csv: prefix keeps urls without a .csv extension working
+		journal, err := runHledgerOn("csv:"+name, "import", "print", "--output-format", "journal")
+		if err != nil {
+			return nil, fmt.Errorf("converting %s: %w", raw, err)
+		}
+		fmt.Fprintf(&out, "; imported from %s\n", raw)
+		out.Write(journal)
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), nil
+}
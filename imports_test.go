@@ -0,0 +1,86 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCSVSource(t *testing.T) {
+	cases := []struct {
+		raw, rules, name string
+	}{
+		{
+			"https://git.example.com/me/ledger/raw/branch/main/bank.csv",
+			"https://git.example.com/me/ledger/raw/branch/main/bank.csv.rules",
+			"bank.csv",
+		},
+		{
+			"https://git.example.com/api/v1/repos/me/ledger/raw/bank.csv?ref=main",
+			"https://git.example.com/api/v1/repos/me/ledger/raw/bank.csv.rules?ref=main",
+			"bank.csv",
+		},
+		{
+			"https://git.example.com/api/v1/repos/me/ledger/raw/exports/giro%20konto.csv?ref=v1",
+			"https://git.example.com/api/v1/repos/me/ledger/raw/exports/giro%20konto.csv.rules?ref=v1",
+			"giro konto.csv",
+		},
+	}
+	for _, tc := range cases {
+		src, err := parseCSVSource(tc.raw)
+		if err != nil {
+			t.Errorf("%s: %v", tc.raw, err)
+			continue
+		}
+		if src.csv != tc.raw || src.rules != tc.rules || src.name != tc.name {
+			t.Errorf("%s: got %+v, want rules %s and name %s", tc.raw, src, tc.rules, tc.name)
+		}
+	}
+}
+
+func TestImportCSVsFromBothURLForms(t *testing.T) {
+	files := map[string]string{
+		"/me/ledger/raw/branch/main/bank.csv":                 "date,amount\n2024-01-02,-5\n",
+		"/me/ledger/raw/branch/main/bank.csv.rules":           "fields date, amount\n",
+		"/api/v1/repos/me/ledger/raw/card.csv?ref=main":       "date,amount\n2024-01-03,-7\n",
+		"/api/v1/repos/me/ledger/raw/card.csv.rules?ref=main": "fields date, amount\n",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.RequestURI()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	defer func(imports []string) { cfg.CSVImports = imports }(cfg.CSVImports)
+	cfg.CSVImports = []string{
+		srv.URL + "/me/ledger/raw/branch/main/bank.csv",
+		srv.URL + "/api/v1/repos/me/ledger/raw/card.csv?ref=main",
+	}
+	defer func(exec func(...string) ([]byte, []byte, error)) { hledgerExec = exec }(hledgerExec)
+	var converted []string
+	hledgerExec = func(args ...string) ([]byte, []byte, error) {
+		name := strings.TrimPrefix(args[1], "csv:")
+		if _, err := os.Stat(name + ".rules"); err != nil {
+			t.Errorf("no rules next to %s: %v", name, err)
+		}
+		converted = append(converted, filepath.Base(name))
+		return []byte("2024-01-02 imported\n"), nil, nil
+	}
+
+	if _, err := importCSVs("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(converted, " ") != "0-bank.csv 1-card.csv" {
+		t.Errorf("converted %q", converted)
+	}
+}
@@ -0,0 +1,115 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var ledgerExpensesMonthlyReal = newGaugeFamily(
+	prometheus.GaugeOpts{
+		Name: "ledger_expenses_monthly_real",
+		Help: "Monthly expenses by category, currency and month in today's purchasing power, per INFLATION_INDEXES",
+	},
+	[]string{"category", "currency", "month"},
+)
+
+// parseInflationIndexes reads "EUR=HICP,USD=CPI" into a map from currency
+// code to the commodity whose P directives track its price index.
+func parseInflationIndexes(v string) (map[string]string, error) {
+	indexes := map[string]string{}
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		currency, commodity, ok := strings.Cut(item, "=")
+		currency, commodity = strings.TrimSpace(currency), strings.TrimSpace(commodity)
+		if !ok || currency == "" || commodity == "" {
+			return nil, fmt.Errorf("expected currency=commodity, got %q", item)
+		}
+		indexes[currencyCode(currency)] = commodity
+	}
+	return indexes, nil
+}
+
+// indexSeries is the values of one price index in date order.
+type indexSeries []marketPrice
+
+// at returns the index for month, i.e. its last value dated within or
+// before that month.
+func (s indexSeries) at(month string) (float64, bool) {
+	start, err := time.Parse("2006-01", month)
+	if err != nil {
+		return 0, false
+	}
+	next := start.AddDate(0, 1, 0)
+	i := sort.Search(len(s), func(i int) bool { return !s[i].date.Before(next) })
+	if i == 0 {
+		return 0, false
+	}
+	return s[i-1].value, true
+}
+
+// publishRealExpenses scales each month of the monthly report by the
+// ratio of the latest index value to that month's. Currencies without a
+// configured index and months before the index starts are left out.
+func publishRealExpenses(parsed monthlyAmounts, now time.Time) error {
+	out, err := runHledger("monthly", "prices")
+	if err != nil {
+		return fmt.Errorf("hledger prices: %w", err)
+	}
+	series := map[string]indexSeries{}
+	commodityCurrency := map[string][]string{}
+	for currency, commodity := range cfg.InflationIndexes {
+		commodityCurrency[commodity] = append(commodityCurrency[commodity], currency)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		p, err := parsePriceLine(sc.Text())
+		if err != nil || p.date.After(now) || p.value <= 0 {
+			// only index prices matter here, the rest may well not parse
+			continue
+		}
+		for _, currency := range commodityCurrency[p.commodity] {
+			series[currency] = append(series[currency], p)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("reading prices: %w", err)
+	}
+
+	adjusted := newSampleSet()
+	for currency, s := range series {
+		sort.SliceStable(s, func(i, j int) bool { return s[i].date.Before(s[j].date) })
+		latest := s[len(s)-1].value
+		for k, months := range parsed {
+			if k.currency != currency {
+				continue
+			}
+			for month, amount := range months {
+				if index, ok := s.at(month); ok {
+					adjusted.set(amount*latest/index, k.category, k.currency, month)
+				}
+			}
+		}
+	}
+	for currency, commodity := range cfg.InflationIndexes {
+		if _, ok := series[currency]; !ok {
+			log.Printf("WARNING: no prices for %s, the inflation index of %s", commodity, currency)
+		}
+	}
+	ledgerExpensesMonthlyReal.publish(adjusted)
+	return nil
+}
@@ -0,0 +1,92 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// optionalLabels may legitimately be empty. currency is empty for every
+// commodity other than € and $, e.g. shares left unvalued.
+var optionalLabels = map[string]bool{"month_tag": true, "valuation_currency": true, "currency": true}
+
+// totalTolerance absorbs float error when comparing sums with totals.
+const totalTolerance = 0.005
+
+// checkInvariants verifies gathered metrics the way a consumer relies on
+// them: every family is described, labels aren't empty, the balance totals
+// match their accounts per currency and every month lies within the
+// RETAIN_MONTHS window, none of them in the future.
+func checkInvariants(families []*dto.MetricFamily, now time.Time) []error {
+	var errs []error
+	byName := map[string]*dto.MetricFamily{}
+	currentMonth := now.Format("2006-01")
+	oldestMonth := oldestRetainedMonth(now)
+	for _, mf := range families {
+		byName[mf.GetName()] = mf
+		if mf.GetHelp() == "" || mf.Type == nil {
+			errs = append(errs, fmt.Errorf("%s: missing HELP or TYPE", mf.GetName()))
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetValue() == "" && !optionalLabels[l.GetName()] {
+					errs = append(errs, fmt.Errorf("%s: empty %s label", mf.GetName(), l.GetName()))
+				}
+				// months are zero padded, so they compare as strings
+				if l.GetName() == "month" && l.GetValue() > currentMonth {
+					errs = append(errs, fmt.Errorf("%s: month %s is in the future", mf.GetName(), l.GetValue()))
+				}
+				if l.GetName() == "month" && l.GetValue() < oldestMonth {
+					errs = append(errs, fmt.Errorf("%s: month %s is before the RETAIN_MONTHS window starting %s",
+						mf.GetName(), l.GetValue(), oldestMonth))
+				}
+			}
+		}
+	}
+
+	for _, f := range balanceFamilies {
+		accounts, total := byName[f.accounts.name], byName[f.total.name]
+		if accounts == nil || total == nil {
+			continue
+		}
+		if cfg.MaxSeriesPerMetric > 0 && len(accounts.GetMetric()) >= cfg.MaxSeriesPerMetric {
+			// some accounts may have been dropped
+			continue
+		}
+		sums := map[string]float64{}
+		for _, m := range accounts.GetMetric() {
+			sums[labelValue(m, "currency")] += m.GetGauge().GetValue()
+		}
+		for _, m := range total.GetMetric() {
+			currency := labelValue(m, "currency")
+			if want := m.GetGauge().GetValue(); math.Abs(sums[currency]-want) > totalTolerance {
+				errs = append(errs, fmt.Errorf("%s{currency=%q} is %.2f, its accounts add up to %.2f",
+					f.total.name, currency, want, sums[currency]))
+			}
+		}
+	}
+	return errs
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+// formatErrors joins errs one per line for -probe.
+func formatErrors(errs []error) string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = "  " + err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,183 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const journalChangeFile = "journal_change.json"
+
+var (
+	journalChangedTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ledger_exporter_journal_changed_timestamp_seconds",
+			Help: "When a refresh last fetched a journal with different content, 0 if none did yet",
+		},
+	)
+
+	journalChangeMagnitude = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ledger_exporter_journal_change_magnitude",
+			Help: "Transactions added plus removed by the last fetch, an edited one counts as both",
+		},
+	)
+)
+
+// journalChangeState is the file format in STATE_DIR.
+type journalChangeState struct {
+	Version int       `json:"version"`
+	Hash    string    `json:"hash"`
+	Changed time.Time `json:"changed"`
+	// Transactions are the fingerprints of the journal's transactions.
+	Transactions []string `json:"transactions"`
+}
+
+// journalChanges remembers the last fetched journal across refreshes, and
+// across restarts when STATE_DIR is set.
+type journalChanges struct {
+	mu     sync.Mutex
+	loaded bool
+	state  journalChangeState
+}
+
+var journalChange journalChanges
+
+func (c *journalChanges) load() {
+	if c.loaded || cfg.StateDir == "" {
+		c.loaded = true
+		return
+	}
+	c.loaded = true
+	data, err := os.ReadFile(filepath.Join(cfg.StateDir, journalChangeFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	var state journalChangeState
+	if err == nil {
+		err = json.Unmarshal(data, &state)
+	}
+	if err == nil && state.Version != 1 {
+		err = fmt.Errorf("unknown version %d", state.Version)
+	}
+	if err != nil {
+		log.Printf("WARNING: discarding journal change state: %v", err)
+		return
+	}
+	c.state = state
+	if !state.Changed.IsZero() {
+		journalChangedTimestamp.Set(float64(state.Changed.Unix()))
+	}
+}
+
+func (c *journalChanges) save() error {
+	if cfg.StateDir == "" {
+		return nil
+	}
+	data, err := json.Marshal(c.state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(cfg.StateDir, journalChangeFile), data)
+}
+
+// record compares the journal at path with the last one recorded. The
+// very first journal only sets the baseline.
+func (c *journalChanges) record(path string, now time.Time) error {
+	hash, txns, err := fingerprintJournal(path)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.load()
+	if hash == c.state.Hash {
+		journalChangeMagnitude.Set(0)
+		return nil
+	}
+	if c.state.Hash != "" {
+		c.state.Changed = now
+		journalChangedTimestamp.Set(float64(now.Unix()))
+		journalChangeMagnitude.Set(float64(txnDifference(c.state.Transactions, txns)))
+	}
+	c.state = journalChangeState{Version: 1, Hash: hash, Changed: c.state.Changed, Transactions: txns}
+	return c.save()
+}
+
+// txnDifference counts the fingerprints only one of a and b has, as
+// multisets, so a duplicated transaction counts too.
+func txnDifference(a, b []string) int {
+	count := map[string]int{}
+	for _, t := range a {
+		count[t]++
+	}
+	for _, t := range b {
+		count[t]--
+	}
+	n := 0
+	for _, c := range count {
+		n += max(c, -c)
+	}
+	return n
+}
+
+// fingerprintJournal hashes the whole journal, and every transaction on
+// its own. A transaction starts with an unindented date, or a ~ or = for
+// periodic and auto postings, and runs over the indented lines after it.
+func fingerprintJournal(path string) (string, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	whole := sha256.New()
+	var txns []string
+	var block []string
+	flush := func() {
+		if len(block) > 0 {
+			h := fnv.New64a()
+			io.WriteString(h, strings.Join(block, "\n"))
+			txns = append(txns, strconv.FormatUint(h.Sum64(), 16))
+			block = nil
+		}
+	}
+	sc := bufio.NewScanner(io.TeeReader(f, whole))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), " \t\r")
+		switch {
+		case line == "":
+			flush()
+		case line[0] == ' ' || line[0] == '\t':
+			if block != nil {
+				block = append(block, line)
+			}
+		case line[0] >= '0' && line[0] <= '9' || line[0] == '~' || line[0] == '=':
+			flush()
+			block = []string{line}
+		default:
+			flush()
+		}
+	}
+	flush()
+	if err := sc.Err(); err != nil {
+		return "", nil, err
+	}
+	return hex.EncodeToString(whole.Sum(nil)), txns, nil
+}
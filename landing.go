@@ -0,0 +1,92 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+)
+
+var landingTemplate = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html>
+<head><title>ledger exporter</title></head>
+<body>
+<h1>ledger exporter</h1>
+<p><a href="/metrics">metrics</a> &middot; <a href="/livez">livez</a> &middot; <a href="/readyz">readyz</a></p>
+<h2>collectors</h2>
+<table>
+<tr><th>name</th><th>enabled</th><th>last duration</th><th>last failure</th></tr>
+{{range .}}<tr><td>{{.Name}}</td><td>{{.Enabled}}</td><td>{{.Duration}}</td><td>{{.Failure}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+type landingCollector struct {
+	Name     string
+	Enabled  bool
+	Duration time.Duration
+	Failure  string
+}
+
+// failureReason is what the unauthenticated landing page may say about a
+// collector error: hledger's classified reason or just that it failed.
+// The error itself quotes journal lines, payees and amounts included, and
+// only goes to the log.
+func failureReason(err error) string {
+	if err == nil {
+		return ""
+	}
+	var herr *hledgerError
+	if errors.As(err, &herr) {
+		return herr.reason
+	}
+	return "failed"
+}
+
+func landingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	var rows []landingCollector
+	for _, c := range collectors {
+		d, err := c.status()
+		rows = append(rows, landingCollector{
+			Name:     c.name,
+			Enabled:  c.isEnabled(),
+			Duration: d.Round(time.Millisecond),
+			Failure:  failureReason(err),
+		})
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := landingTemplate.Execute(w, rows); err != nil {
+		log.Printf("rendering landing page: %v", err)
+	}
+}
+
+// configHandler serves the effective configuration, credentials redacted.
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	// the redacted configuration plus the hledger runs it led to
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		log.Printf("encoding configuration: %v", err)
+		return
+	}
+	var out map[string]any
+	if err := json.Unmarshal(data, &out); err != nil {
+		log.Printf("encoding configuration: %v", err)
+		return
+	}
+	out["HledgerArgs"] = argvSnapshot()
+	if err := enc.Encode(out); err != nil {
+		log.Printf("encoding configuration: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLandingHidesJournalContents(t *testing.T) {
+	c := collectorByName(t, "payee")
+	c.mu.Lock()
+	old := c.lastErr
+	c.lastErr = fmt.Errorf("hledger print: %w", &hledgerError{
+		reason: "assertion",
+		stderr: "main.journal:12:5:\n12 | 2024-03-02 Dr. Secret Clinic\n   |     assets:bank  -480.00 € = 1234.56 €\nbalance assertion failed",
+		err:    errors.New("exit status 1"),
+	})
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.lastErr = old
+		c.mu.Unlock()
+	}()
+
+	rec := httptest.NewRecorder()
+	landingHandler(rec, httptest.NewRequest("GET", "/", nil))
+	body := rec.Body.String()
+	for _, leak := range []string{"Secret Clinic", "1234.56", "main.journal"} {
+		if strings.Contains(body, leak) {
+			t.Errorf("landing page shows %q", leak)
+		}
+	}
+	if !strings.Contains(body, "<td>assertion</td>") {
+		t.Errorf("landing page doesn't show the failure reason:\n%s", body)
+	}
+}
+
+func TestFailureReason(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{&hledgerError{reason: "parse_error", stderr: "1 | 2024-03-02 Bakery"}, "parse_error"},
+		{errors.New("reading csv: bare \" in non-quoted field"), "failed"},
+	}
+	for _, c := range cases {
+		if got := failureReason(c.err); got != c.want {
+			t.Errorf("failureReason(%v) = %q, want %q", c.err, got, c.want)
+		}
+	}
+}
+
+func collectorByName(t *testing.T, name string) *collector {
+	t.Helper()
+	for _, c := range collectors {
+		if c.name == name {
+			return c
+		}
+	}
+	t.Fatalf("no collector %s", name)
+	return nil
+}
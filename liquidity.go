@@ -0,0 +1,111 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ledgerTotalAssetsLiquid = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_total_assets_liquid",
+			Help: "Total of the asset accounts matching LIQUID_ACCOUNTS by currency",
+		},
+		[]string{"currency"},
+	)
+
+	ledgerTotalAssetsIlliquid = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_total_assets_illiquid",
+			Help: "Total of the asset accounts not matching LIQUID_ACCOUNTS by currency",
+		},
+		[]string{"currency"},
+	)
+
+	// liquidChecked is set once LIQUID_ACCOUNTS has been checked against
+	// the first successful asset listing.
+	liquidChecked atomic.Bool
+)
+
+// accountPatterns are anchored regular expressions over account names.
+type accountPatterns []*regexp.Regexp
+
+func parseAccountPatterns(patterns []string) (accountPatterns, error) {
+	var res accountPatterns
+	for _, p := range patterns {
+		re, err := regexp.Compile("^(?:" + p + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func (ps accountPatterns) MarshalJSON() ([]byte, error) {
+	strs := make([]string, len(ps))
+	for i, re := range ps {
+		strs[i] = re.String()
+	}
+	return json.Marshal(strs)
+}
+
+// match returns the index of the first pattern matching the asset account
+// label, tried both bare and with the prefixes trimmed from it.
+func (ps accountPatterns) match(label string) int {
+	for i, re := range ps {
+		if re.MatchString(label) {
+			return i
+		}
+		for _, t := range cfg.AccountTypes {
+			if t.Family == "assets" && re.MatchString(t.Prefix+label) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// publishLiquidity splits ledger_total_assets into liquid and illiquid.
+// The illiquid part is whatever the liquid accounts leave of the total, so
+// the two always add up to it.
+func publishLiquidity() {
+	if len(cfg.LiquidAccounts) == 0 {
+		return
+	}
+	liquid := newSampleSet()
+	used := make([]bool, len(cfg.LiquidAccounts))
+	for _, s := range assetGauge.snapshot() {
+		i := cfg.LiquidAccounts.match(s.labels[0])
+		if i < 0 {
+			continue
+		}
+		used[i] = true
+		liquid.add(s.value, s.labels[1])
+	}
+	illiquid := newSampleSet()
+	for _, s := range ledgerTotalAssets.snapshot() {
+		l, _ := liquid.get(s.labels[0])
+		illiquid.set(s.value-l, s.labels[0])
+	}
+	ledgerTotalAssetsLiquid.publish(liquid)
+	ledgerTotalAssetsIlliquid.publish(illiquid)
+
+	// A failed refresh or an empty journal lists no accounts, which would
+	// make every pattern look wrong, so the check waits for real ones. It
+	// is a configuration problem, not a parse warning.
+	if assetGauge.len() > 0 && !liquidChecked.Swap(true) {
+		for i, ok := range used {
+			if !ok {
+				log.Printf("WARNING: LIQUID_ACCOUNTS pattern %q matches no asset account", cfg.LiquidAccounts[i])
+			}
+		}
+	}
+}
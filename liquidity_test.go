@@ -0,0 +1,58 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestUnmatchedLiquidPatterns(t *testing.T) {
+	old := cfg
+	defer func() { cfg = old }()
+	cfg.AccountTypes = defaultAccountTypes()
+	patterns, err := parseAccountPatterns([]string{"assets:bank.*", "assets:wallet"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.LiquidAccounts = patterns
+	defer liquidChecked.Store(liquidChecked.Load())
+	liquidChecked.Store(false)
+
+	var logged bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logged)
+	warningsBefore := warningCount.Load()
+	refresh := func(accounts ...string) string {
+		logged.Reset()
+		assets, totals := newSampleSet(), newSampleSet()
+		for _, a := range accounts {
+			assets.set(100, a, "EUR")
+			totals.add(100, "EUR")
+		}
+		assetGauge.publish(assets)
+		ledgerTotalAssets.publish(totals)
+		publishLiquidity()
+		return logged.String()
+	}
+
+	// a failed first refresh lists no accounts at all
+	if out := refresh(); strings.Contains(out, "LIQUID_ACCOUNTS") {
+		t.Errorf("patterns reported before any account was listed: %q", out)
+	}
+	out := refresh("bank:checking", "broker")
+	if !strings.Contains(out, `"^(?:assets:wallet)$" matches no asset account`) {
+		t.Errorf("unmatched pattern not reported: %q", out)
+	}
+	if strings.Contains(out, "bank") {
+		t.Errorf("matching pattern reported: %q", out)
+	}
+	if out := refresh("bank:checking", "broker"); strings.Contains(out, "LIQUID_ACCOUNTS") {
+		t.Errorf("reported again on the next refresh: %q", out)
+	}
+	if n := warningCount.Load() - warningsBefore; n != 0 {
+		t.Errorf("counted %d parse warnings for a configuration problem", n)
+	}
+}
@@ -3,13 +3,19 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"os"
-	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
@@ -17,13 +23,30 @@ import (
 	"unicode/utf8"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-const ledgerPath = "/tmp/main.journal"
+var ledgerPath = sandboxDir + "/main.journal"
+
+// gzipMagic is the two-byte header every gzip stream starts with.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// httpClient is used for every outbound request, through doOutbound. The
+// transport adds Accept-Encoding: gzip on its own and transparently
+// decompresses the response, as long as nobody sets that header by hand.
+var httpClient = &http.Client{
+	Timeout:   10 * time.Second,
+	Transport: instrumentedTransport{next: http.DefaultTransport},
+}
 
 var (
-	expenseGauge = prometheus.NewGaugeVec(
+	journalBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ledger_exporter_journal_bytes",
+			Help: "Size of the last fetched journal including CSV imports",
+		},
+	)
+
+	expenseGauge = newGaugeFamily(
 		prometheus.GaugeOpts{
 			Name: "ledger_expenses",
 			Help: "Expenses per category and currency",
@@ -31,7 +54,7 @@ var (
 		[]string{"category", "currency"},
 	)
 
-	assetGauge = prometheus.NewGaugeVec(
+	assetGauge = newGaugeFamily(
 		prometheus.GaugeOpts{
 			Name: "ledger_assets",
 			Help: "Assets per account and currency",
@@ -39,7 +62,7 @@ var (
 		[]string{"account", "currency"},
 	)
 
-	incomeGauge = prometheus.NewGaugeVec(
+	incomeGauge = newGaugeFamily(
 		prometheus.GaugeOpts{
 			Name: "ledger_income",
 			Help: "Income per account and currency",
@@ -47,7 +70,15 @@ var (
 		[]string{"account", "currency"},
 	)
 
-	ledgerTotalExpenses = prometheus.NewGaugeVec(
+	liabilityGauge = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_liabilities",
+			Help: "Liabilities per account and currency",
+		},
+		[]string{"account", "currency"},
+	)
+
+	ledgerTotalExpenses = newGaugeFamily(
 		prometheus.GaugeOpts{
 			Name: "ledger_total_expenses",
 			Help: "Total expenses by currency",
@@ -55,7 +86,7 @@ var (
 		[]string{"currency"},
 	)
 
-	ledgerTotalAssets = prometheus.NewGaugeVec(
+	ledgerTotalAssets = newGaugeFamily(
 		prometheus.GaugeOpts{
 			Name: "ledger_total_assets",
 			Help: "Total assets by currency",
@@ -63,7 +94,7 @@ var (
 		[]string{"currency"},
 	)
 
-	ledgerTotalIncome = prometheus.NewGaugeVec(
+	ledgerTotalIncome = newGaugeFamily(
 		prometheus.GaugeOpts{
 			Name: "ledger_total_income",
 			Help: "Total income by currency",
@@ -71,7 +102,31 @@ var (
 		[]string{"currency"},
 	)
 
-	ledgerExpensesMonthly = prometheus.NewGaugeVec(
+	ledgerTotalLiabilities = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_total_liabilities",
+			Help: "Total liabilities by currency",
+		},
+		[]string{"currency"},
+	)
+
+	equityGauge = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_equity",
+			Help: "Equity per account and currency",
+		},
+		[]string{"account", "currency"},
+	)
+
+	ledgerTotalEquity = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_total_equity",
+			Help: "Total equity by currency",
+		},
+		[]string{"currency"},
+	)
+
+	ledgerExpensesMonthly = newGaugeFamily(
 		prometheus.GaugeOpts{
 			Name: "ledger_expenses_monthly",
 			Help: "Monthly expenses by category, currency, and month",
@@ -79,13 +134,37 @@ var (
 		[]string{"category", "currency", "month", "month_tag"},
 	)
 
-	ledgerExpenseByPayee = prometheus.NewGaugeVec(
+	ledgerExpenseByPayee = newGaugeFamily(
 		prometheus.GaugeOpts{
 			Name: "ledger_expense_by_payee",
 			Help: "Monthly aggregated expenses by normalized payee",
 		},
 		[]string{"payee", "currency", "month", "month_tag"},
 	)
+
+	ledgerExpensesGrossMonthly = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_expenses_gross_monthly",
+			Help: "Monthly expenses by category before refunds, summing only positive postings",
+		},
+		[]string{"category", "currency", "month"},
+	)
+
+	ledgerExpenseTransactionsMonthly = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_expense_transactions_monthly",
+			Help: "Number of transactions per expense category, currency and month",
+		},
+		[]string{"category", "currency", "month", "month_tag"},
+	)
+
+	ledgerRefundsMonthly = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_refunds_monthly",
+			Help: "Monthly refunds by category, summing only negative expense postings (always <= 0)",
+		},
+		[]string{"category", "currency", "month"},
+	)
 )
 
 func parseAmount(s string) (float64, error) {
@@ -98,44 +177,198 @@ func normalizePayee(s string) string {
 	return s
 }
 
+// fetchTo streams url from Gitea into w, undoing gzip compression the
+// transport didn't handle, e.g. a proxy serving a .gz body without a
+// Content-Encoding header. It refuses anything that doesn't look like text
+// and stops with an error once more than cfg.MaxJournalBytes arrived. It
+// returns how many bytes were written.
+func fetchTo(w io.Writer, token, url string) (int64, error) {
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Authorization", "token "+token)
+	resp, err := doOutbound(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("fetching %s returned %s", url, resp.Status)
+	}
+
+	body := bufio.NewReader(resp.Body)
+	var r io.Reader = body
+	contentType := resp.Header.Get("Content-Type")
+	if magic, _ := body.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return 0, fmt.Errorf("%s looks gzipped but can't be read: %w", url, err)
+		}
+		defer zr.Close()
+		// the header describes the compressed body
+		r, contentType = zr, ""
+	}
+	sniffed := bufio.NewReaderSize(r, sniffLen)
+	// a short body is fine, read errors show up again in the copy below
+	head, _ := sniffed.Peek(sniffLen)
+	if err := checkText(contentType, head); err != nil {
+		return 0, fmt.Errorf("%s: %w", url, err)
+	}
+
+	limit := cfg.MaxJournalBytes
+	if limit <= 0 {
+		return io.Copy(w, sniffed)
+	}
+	n, err := io.Copy(w, io.LimitReader(sniffed, limit+1))
+	if err != nil {
+		return n, err
+	}
+	if n > limit {
+		return n, fmt.Errorf("%s is larger than MAX_JOURNAL_BYTES (%d bytes), refusing it", url, limit)
+	}
+	return n, nil
+}
+
+// sniffLen is how much of a download checkText looks at, as much as
+// http.DetectContentType considers.
+const sniffLen = 512
+
+// checkText rejects downloads whose Content-Type or first bytes aren't
+// plain text, e.g. an archive or a login page.
+func checkText(contentType string, head []byte) error {
+	if contentType != "" {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		switch mediaType {
+		case "text/plain", "text/csv", "application/octet-stream":
+		default:
+			return fmt.Errorf("served as %s, not as a text file", contentType)
+		}
+	}
+	if sniffed := http.DetectContentType(head); !strings.HasPrefix(sniffed, "text/plain") {
+		return fmt.Errorf("content looks like %s, not like a text file", sniffed)
+	}
+	return nil
+}
+
+// fetchRaw downloads url from Gitea into memory, see fetchTo.
+func fetchRaw(token, url string) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := fetchTo(&buf, token, url); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeFileAtomic replaces path in one step, so hledger never reads a
+// half-written journal.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
 func fetchJournal() error {
 	log.Println("fetchJournal called")
-	token := os.Getenv("GITEA_TOKEN")
-	url := os.Getenv("GITEA_JOURNAL_URL")
+	token := cfg.GiteaToken
+	url := cfg.GiteaJournalURL
 	if token == "" || url == "" {
 		log.Println("missing GITEA_TOKEN or GITEA_JOURNAL_URL")
 		return nil
 	}
 
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Authorization", "token "+token)
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	// streamed to disk, the journal never has to fit into memory
+	tmp := ledgerPath + ".tmp"
+	defer os.Remove(tmp)
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	data, err := io.ReadAll(resp.Body)
+	size, err := fetchTo(f, token, url)
 	if err != nil {
+		f.Close()
 		return err
 	}
 
-	return os.WriteFile(ledgerPath, data, 0644)
+	// A failed import leaves the imported transactions out rather than
+	// keeping the previous journal around.
+	var importErr error
+	if len(cfg.CSVImports) > 0 {
+		imported, err := importCSVs(token)
+		if err != nil {
+			importErr = fmt.Errorf("importing csv: %w", err)
+		} else {
+			n, err := f.Write(append([]byte{'\n'}, imported...))
+			size += int64(n)
+			if err != nil {
+				f.Close()
+				return err
+			}
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if cfg.StrictIncludes {
+		if err := checkIncludesIn(tmp, sandboxDir); err != nil {
+			return err
+		}
+	}
+	// renaming replaces the journal in one step, so hledger never reads a
+	// half-written one
+	if err := os.Rename(tmp, ledgerPath); err != nil {
+		return err
+	}
+	journalBytes.Set(float64(size))
+	if err := journalChange.record(ledgerPath, time.Now()); err != nil {
+		log.Printf("tracking journal changes: %v", err)
+	}
+	updateJournalCommit(token, url)
+	return importErr
 }
 
-func collectBalances(accountType string, gauge *prometheus.GaugeVec, prefixToTrim string) {
-	log.Printf("collectBalances: %s", accountType)
-	cmd := exec.Command("hledger", "-f", ledgerPath, "-s", "bal", accountType, "--depth", "5", "--no-elide")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
-	if err := cmd.Run(); err != nil {
-		log.Printf("error running hledger for %s: %v\n%s", accountType, err, out.String())
-		return
+// collectBalances runs every ACCOUNT_TYPES query feeding familyName and
+// publishes their accounts and totals, summed where queries overlap.
+func collectBalances(familyName string, family, total *gaugeFamily) error {
+	log.Printf("collectBalances: %s", familyName)
+	accounts := newSampleSet()
+	totals := newSampleSet()
+	for _, t := range cfg.AccountTypes {
+		if t.Family != familyName {
+			continue
+		}
+		// the configured query goes after "--" so hledger never reads it as options
+		args := append([]string{"-s", "bal", "--depth", "5", "--no-elide"}, valuationArgs()...)
+		args = append(append(args, "--"), strings.Fields(t.Query)...)
+		out, err := runHledger("balances", args...)
+		if err != nil {
+			return fmt.Errorf("running hledger for %s: %w", t.Query, err)
+		}
+		a, tot := parseBalanceReport(out, func(account string) (string, bool) {
+			return strings.TrimPrefix(account, t.Prefix), true
+		})
+		accounts.merge(a)
+		totals.merge(tot)
+	}
+	checkConsistency(familyName, accounts, totals)
+	if familyName == "expenses" && cfg.MemberDimension.enabled() {
+		var err error
+		if accounts, err = memberBalances(accounts); err != nil {
+			return fmt.Errorf("member split: %w", err)
+		}
 	}
-	gauge.Reset()
-	for _, line := range strings.Split(out.String(), "\n") {
+	family.publish(accounts)
+	total.publish(totals)
+	return nil
+}
+
+// parseBalanceReport reads the per-account lines and the total lines of a
+// single-column `hledger bal` report. label turns an account into its
+// account label, accounts it rejects are skipped.
+func parseBalanceReport(out []byte, label func(account string) (string, bool)) (accounts, totals *sampleSet) {
+	accounts = newSampleSet()
+	totals = newSampleSet()
+	for _, line := range strings.Split(string(out), "\n") {
 		line = strings.TrimSpace(line)
 		if line == "" || strings.Contains(line, "----") {
 			continue
@@ -146,56 +379,67 @@ func collectBalances(accountType string, gauge *prometheus.GaugeVec, prefixToTri
 			amountStr := line[runeSize:]
 			amount, err := parseAmount(amountStr)
 			if err != nil {
-				log.Printf("could not parse total line %q: %v", line, err)
+				warnf("could not parse total line %q: %v", line, err)
 				continue
 			}
 			currency := map[string]string{"€": "EUR", "$": "USD"}[string(firstRune)]
-			switch accountType {
-			case "expenses":
-				ledgerTotalExpenses.WithLabelValues(currency).Set(amount)
-			case "assets":
-				ledgerTotalAssets.WithLabelValues(currency).Set(amount)
-			case "income":
-				ledgerTotalIncome.WithLabelValues(currency).Set(amount)
-			}
+			totals.set(amount, currency)
 			continue
 		}
 		if len(parts) < 2 {
-			log.Printf("skipping line: %q", line)
+			warnf("skipping line: %q", line)
 			continue
 		}
 		firstRune, runeSize := utf8.DecodeRuneInString(parts[0])
 		amountStr := parts[0][runeSize:]
 		amount, err := parseAmount(amountStr)
 		if err != nil {
-			log.Printf("could not parse amount %q: %v", parts[0], err)
+			warnf("could not parse amount %q: %v", parts[0], err)
 			continue
 		}
 		currency := map[string]string{"€": "EUR", "$": "USD"}[string(firstRune)]
-		account := strings.TrimPrefix(parts[1], prefixToTrim)
-		gauge.WithLabelValues(account, currency).Set(amount)
+		account, ok := label(parts[1])
+		if !ok {
+			continue
+		}
+		accounts.addFrom(parts[1], amount, account, currency)
+	}
+	return accounts, totals
+}
+
+// monthlyKey identifies one category/currency series of the monthly report.
+type monthlyKey struct {
+	category string
+	currency string
+}
+
+// monthlyAmounts holds the parsed monthly report, keyed by category and
+// currency and then by month ("2006-01"), for the derived metrics.
+type monthlyAmounts map[monthlyKey]map[string]float64
+
+func (m monthlyAmounts) add(k monthlyKey, month string, amount float64) {
+	if m[k] == nil {
+		m[k] = map[string]float64{}
 	}
+	m[k][month] += amount
 }
 
-func collectMonthlyExpenses() {
+func collectMonthlyExpenses() error {
 	log.Println("collectMonthlyExpenses called")
-	cmd := exec.Command("hledger", "-f", ledgerPath, "-s", "reg", "expenses", "--monthly", "--output-format", "csv")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
-	if err := cmd.Run(); err != nil {
-		log.Printf("hledger reg failed: %v\nOutput:\n%s", err, out.String())
-		return
+	args := append([]string{"-s", "reg", "--monthly", "--output-format", "csv"}, valuationArgs()...)
+	out, err := runHledger("monthly", append(append(args, "--"), familyQuery("expenses")...)...)
+	if err != nil {
+		return fmt.Errorf("hledger reg: %w", err)
 	}
-	r := csv.NewReader(strings.NewReader(out.String()))
+	r := csv.NewReader(bytes.NewReader(out))
 	records, err := r.ReadAll()
 	if err != nil {
-		log.Printf("error reading csv output: %v", err)
-		return
+		return fmt.Errorf("reading csv output: %w", err)
 	}
-	ledgerExpensesMonthly.Reset()
+	monthly := newSampleSet()
+	parsed := monthlyAmounts{}
 
-	now := time.Now()
+	now := clock()
 	currentMonth := now.Format("2006-01")
 	firstOfThisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
 	previousMonth := firstOfThisMonth.AddDate(0, 0, -1).Format("2006-01")
@@ -204,8 +448,16 @@ func collectMonthlyExpenses() {
 		if i == 0 || len(rec) < 6 {
 			continue
 		}
-		month := rec[1][:7]
-		category := strings.TrimPrefix(rec[4], "expenses:")
+		date, err := time.Parse("2006-01-02", strings.TrimSpace(rec[1]))
+		if err != nil {
+			warnf("could not parse monthly date %q: %v", rec[1], err)
+			continue
+		}
+		month := date.Format("2006-01")
+		category, ok := familyLabel("expenses", rec[4])
+		if !ok {
+			continue
+		}
 		amountStr := strings.TrimSpace(rec[5])
 		if amountStr == "" {
 			continue
@@ -214,6 +466,7 @@ func collectMonthlyExpenses() {
 		amountNum := amountStr[runeSize:]
 		amount, err := parseAmount(amountNum)
 		if err != nil {
+			warnf("could not parse monthly amount %q: %v", amountStr, err)
 			continue
 		}
 		currency := map[string]string{"€": "EUR", "$": "USD"}[string(firstRune)]
@@ -224,117 +477,170 @@ func collectMonthlyExpenses() {
 		} else if month == previousMonth {
 			monthTag = "previous"
 		}
-		ledgerExpensesMonthly.WithLabelValues(category, currency, month, monthTag).Set(amount)
+		monthly.addFrom(rec[4], amount, category, currency, month, monthTag)
+		parsed.add(monthlyKey{category, currency}, month, amount)
+	}
+	if cfg.MemberDimension.enabled() {
+		if monthly, err = memberMonthly(monthly); err != nil {
+			return fmt.Errorf("member split: %w", err)
+		}
+	}
+	ledgerExpensesMonthly.publish(monthly)
+	collectExpenseTrends(parsed, now)
+	publishMonthlyExpenseGroups(parsed)
+	publishExpenseShare(parsed, now)
+	if len(cfg.InflationIndexes) > 0 {
+		if err := publishRealExpenses(parsed, now); err != nil {
+			return err
+		}
 	}
+	if cfg.EmitAverages {
+		return collectMonthlyAverages(now)
+	}
+	return nil
 }
 
-func collectExpenseTotalsByPayee() {
+func collectExpenseTotalsByPayee() error {
 	log.Println("collectExpenseTotalsByPayee called")
-	cmd := exec.Command("hledger", "-f", ledgerPath, "print", "expenses", "--output-format", "csv")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
-	if err := cmd.Run(); err != nil {
-		log.Printf("hledger print failed: %v\n%s", err, out.String())
-		return
-	}
-	r := csv.NewReader(strings.NewReader(out.String()))
-	records, err := r.ReadAll()
+	// valued like the monthly register, see below
+	postings, err := runValuedPrint("payee", familyQuery("expenses")...)
 	if err != nil {
-		log.Printf("error reading csv: %v", err)
-		return
+		return err
 	}
-	ledgerExpenseByPayee.Reset()
-	totals := map[string]map[string]float64{}
-	currencies := map[string]string{}
-	now := time.Now()
+	byPayee := newSampleSet()
+	gross := newSampleSet()
+	refunds := newSampleSet()
+	// a transaction splitting one category over several postings counts once
+	type txnKey struct{ txn, category, currency, month string }
+	counted := map[txnKey]bool{}
+	counts := newSampleSet()
+	now := clock()
 	currentMonth := now.Format("2006-01")
 	firstOfThisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
 	previousMonth := firstOfThisMonth.AddDate(0, 0, -1).Format("2006-01")
 
-	for i, rec := range records {
-		if i == 0 || len(rec) < 12 {
+	for _, p := range postings {
+		category, ok := familyCategory("expenses", p.account)
+		if !ok {
 			continue
 		}
+		month := p.month()
 
-		dateStr := strings.TrimSpace(rec[1])              // date
-		desc := normalizePayee(strings.TrimSpace(rec[5])) // description
-		account := strings.TrimSpace(rec[7])              // account
-		amountStr := strings.TrimSpace(rec[11])           // debit
-		currencySymbol := strings.TrimSpace(rec[9])       // commodity column
-
-		if !strings.HasPrefix(account, "expenses:") {
-			continue
+		// Gross and refunds split the same postings the monthly register
+		// nets, at the same VALUATION, so gross + refunds ==
+		// ledger_expenses_monthly.
+		monthTag := ""
+		if month == currentMonth {
+			monthTag = "current"
+		} else if month == previousMonth {
+			monthTag = "previous"
 		}
-
-		parsedDate, err := time.Parse("2006-01-02", dateStr)
-		if err != nil || amountStr == "" {
+		if k := (txnKey{p.txn, category, p.currency, month}); !counted[k] {
+			counted[k] = true
+			counts.add(1, category, p.currency, month, monthTag)
+		}
+		if p.amount < 0 {
+			refunds.add(p.amount, category, p.currency, month)
 			continue
 		}
-
-		amountVal, err := parseAmount(amountStr)
-		if err != nil || amountVal <= 0 {
+		gross.add(p.amount, category, p.currency, month)
+		if p.amount == 0 {
 			continue
 		}
 
-		currency := map[string]string{"€": "EUR", "$": "USD"}[currencySymbol]
-		month := parsedDate.Format("2006-01")
-
-		if _, ok := totals[desc]; !ok {
-			totals[desc] = map[string]float64{}
-		}
-		totals[desc][month] += amountVal
-		currencies[desc] = currency
-	}
-
-	for payee, monthMap := range totals {
-		for month, amt := range monthMap {
-			currency := currencies[payee]
-			monthTag := ""
-			if month == currentMonth {
-				monthTag = "current"
-			} else if month == previousMonth {
-				monthTag = "previous"
-			}
-			ledgerExpenseByPayee.WithLabelValues(payee, currency, month, monthTag).Set(amt)
+		// descriptions differing only in case and spacing are the same payee,
+		// anything else merged by normalizePayee is reported as a collision
+		source := strings.ToLower(strings.TrimSpace(p.description))
+		lvs := []string{normalizePayee(p.description), p.currency, month, monthTag}
+		if cfg.MemberDimension.enabled() {
+			lvs = append(lvs, cfg.MemberDimension.postingMember(p))
 		}
+		byPayee.addFrom(source, p.amount, lvs...)
 	}
+
+	ledgerExpenseByPayee.publish(byPayee)
+	ledgerExpensesGrossMonthly.publish(gross)
+	ledgerRefundsMonthly.publish(refunds)
+	ledgerExpenseTransactionsMonthly.publish(counts)
+
+	recent := biggestTransactions(postings, now, 3)
+	snapshotMu.Lock()
+	biggestRecent = recent
+	snapshotMu.Unlock()
+	return nil
 }
 
-func updateMetrics() {
+// updateMetrics refreshes the journal and runs every collector. Failures
+// are logged as they happen and the refresh carries on with the next
+// collector; the returned error joins all of them.
+func updateMetrics() error {
 	log.Println("updateMetrics called")
-	if err := fetchJournal(); err != nil {
-		log.Printf("error fetching journal: %v", err)
-	}
-	collectBalances("expenses", expenseGauge, "expenses:")
-	collectBalances("assets", assetGauge, "assets:")
-	collectBalances("income", incomeGauge, "income:")
-	collectMonthlyExpenses()
-	collectExpenseTotalsByPayee()
+	start := time.Now()
+	var errs []error
+	fetchErr := fetchJournal()
+	if fetchErr != nil {
+		log.Printf("error fetching journal: %v", fetchErr)
+		errs = append(errs, fmt.Errorf("fetching journal: %w", fetchErr))
+	}
+	errs = append(errs, runCollectors(collectors)...)
+	if fetchErr == nil {
+		// only now that the collectors ran on it
+		journalFresh.Store(time.Now().UnixNano())
+	}
+	rebuildSnapshot(clock())
+	// history points are observations, REPORT_END doesn't move them
+	recordHistory(time.Now(), time.Since(start))
+	return errors.Join(errs...)
 }
 
 func main() {
+	probe := flag.Bool("probe", false, "run a single refresh, print a summary and exit")
+	diff := flag.Bool("diff", false, "compare the metrics of two journals: -diff old.journal new.journal")
+	diffThreshold := flag.Float64("diff-threshold", 0.01, "smallest value change -diff reports")
+	flag.Parse()
+
 	log.Println("main starting")
-	os.Setenv("LEDGER_FILE", ledgerPath)
-	reg := prometheus.NewRegistry()
-	reg.MustRegister(
-		expenseGauge,
-		assetGauge,
-		incomeGauge,
-		ledgerTotalExpenses,
-		ledgerTotalAssets,
-		ledgerTotalIncome,
-		ledgerExpensesMonthly,
-		ledgerExpenseByPayee,
-	)
-	http.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
-	updateMetrics()
-	go func() {
-		for {
-			time.Sleep(300 * time.Second)
-			updateMetrics()
+	var err error
+	if cfg, err = loadConfig(); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	if data, err := json.Marshal(cfg); err != nil {
+		log.Printf("encoding configuration: %v", err)
+	} else {
+		log.Printf("effective configuration: %s", data)
+	}
+	if cfg.SandboxDir != "" {
+		setSandboxDir(cfg.SandboxDir)
+	}
+	pinClock(cfg.ReportEnd)
+	addMemberLabels()
+	if *diff {
+		if flag.NArg() != 2 {
+			log.Fatalf("usage: %s -diff old.journal new.journal", os.Args[0])
 		}
-	}()
-	log.Println("Exporter listening on :9000")
-	log.Fatal(http.ListenAndServe(":9000", nil))
+		os.Exit(runDiff(os.Stdout, flag.Arg(0), flag.Arg(1), *diffThreshold))
+	}
+	if cfg.TenantsFile != "" {
+		if err := runTenants(cfg.TenantsFile, cfg.ListenAddr); err != nil {
+			log.Fatalf("tenants: %v", err)
+		}
+		return
+	}
+	srv, err := NewServer(cfg)
+	if err != nil {
+		log.Fatalf("setting up: %v", err)
+	}
+	if *probe {
+		os.Exit(runProbe(os.Stdout, srv.reg))
+	}
+	heartbeat.Store(time.Now().UnixNano())
+	runRefresh()
+	go refreshLoop()
+	go watchSignals()
+	l, err := listen(cfg.ListenAddr)
+	if err != nil {
+		log.Fatalf("listening: %v", err)
+	}
+	log.Printf("Exporter listening on %s", l.Addr())
+	log.Fatal(http.Serve(l, srv))
 }
@@ -0,0 +1,109 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const sampleJournal = "2024-01-05 Bakery\n    expenses:food  4.20 €\n    assets:bank\n"
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFetchTo(t *testing.T) {
+	cases := []struct {
+		name    string
+		header  http.Header
+		body    []byte
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "plain",
+			header: http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+			body:   []byte(sampleJournal),
+			want:   sampleJournal,
+		},
+		{
+			name:   "gzip with Content-Encoding",
+			header: http.Header{"Content-Type": {"text/plain"}, "Content-Encoding": {"gzip"}},
+			body:   gzipped(t, sampleJournal),
+			want:   sampleJournal,
+		},
+		{
+			name:   "gzip without Content-Encoding",
+			header: http.Header{"Content-Type": {"application/octet-stream"}},
+			body:   gzipped(t, sampleJournal),
+			want:   sampleJournal,
+		},
+		{
+			name:    "html",
+			header:  http.Header{"Content-Type": {"text/html"}},
+			body:    []byte("<html><body>login</body></html>"),
+			wantErr: "not as a text file",
+		},
+		{
+			name:    "zip",
+			header:  http.Header{"Content-Type": {"application/octet-stream"}},
+			body:    []byte("PK\x03\x04\x14\x00\x00\x00\x08\x00"),
+			wantErr: "not like a text file",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Authorization"); got != "token secret" {
+					t.Errorf("Authorization = %q", got)
+				}
+				for k, v := range tc.header {
+					w.Header()[k] = v
+				}
+				w.Write(tc.body)
+			}))
+			defer srv.Close()
+
+			var buf bytes.Buffer
+			n, err := fetchTo(&buf, "secret", srv.URL)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tc.want || n != int64(len(tc.want)) {
+				t.Errorf("got %d bytes %q, want %q", n, buf.String(), tc.want)
+			}
+		})
+	}
+}
+
+func TestFetchToLimit(t *testing.T) {
+	defer func(limit int64) { cfg.MaxJournalBytes = limit }(cfg.MaxJournalBytes)
+	cfg.MaxJournalBytes = 10
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(gzipped(t, sampleJournal))
+	}))
+	defer srv.Close()
+	if _, err := fetchTo(&bytes.Buffer{}, "secret", srv.URL); err == nil || !strings.Contains(err.Error(), "MAX_JOURNAL_BYTES") {
+		t.Fatalf("err = %v, want the size limit", err)
+	}
+}
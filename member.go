@@ -0,0 +1,202 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// sharedMember is the member of expenses nobody in particular is
+// attributed to.
+const sharedMember = "shared"
+
+// memberDimension says where the household member of an expense posting
+// comes from: the value of a tag, or one segment of the account name.
+type memberDimension struct {
+	Tag string `json:"tag,omitempty"`
+	// Segment indexes the colon separated account name, so 1 picks alice
+	// from expenses:alice:food.
+	Segment int `json:"segment,omitempty"`
+
+	tagRe *regexp.Regexp
+}
+
+// parseMemberDimension reads a segment index like "1" or a tag name like
+// "who". Empty disables the member label.
+func parseMemberDimension(v string) (memberDimension, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return memberDimension{}, nil
+	}
+	if n, err := strconv.Atoi(v); err == nil {
+		if n < 1 {
+			return memberDimension{}, fmt.Errorf("segment index must be at least 1, got %d", n)
+		}
+		return memberDimension{Segment: n}, nil
+	}
+	if strings.ContainsAny(v, " \t:,") {
+		return memberDimension{}, fmt.Errorf("%q is neither a segment index nor a tag name", v)
+	}
+	// like sourceTagRe, values run until the next comma or the end of the line
+	re := regexp.MustCompile(`(?:^|[\s,])` + regexp.QuoteMeta(v) + `:([^,\n]*)`)
+	return memberDimension{Tag: v, tagRe: re}, nil
+}
+
+func (d memberDimension) enabled() bool {
+	return d.Tag != "" || d.Segment > 0
+}
+
+// memberFamilies get a member label when MEMBER_DIMENSION is set.
+var memberFamilies = []*gaugeFamily{expenseGauge, ledgerExpensesMonthly, ledgerExpenseByPayee}
+
+// addMemberLabels extends memberFamilies by the member label. It has to
+// run after the configuration is loaded and before anything is collected
+// or registered.
+func addMemberLabels() {
+	if !cfg.MemberDimension.enabled() {
+		return
+	}
+	for _, f := range memberFamilies {
+		f.addLabel("member")
+	}
+}
+
+// knownMember maps empty values and, with MEMBERS set, anybody not listed
+// to sharedMember.
+func knownMember(m string) string {
+	if m == "" || len(cfg.Members) > 0 && !slices.Contains(cfg.Members, m) {
+		return sharedMember
+	}
+	return m
+}
+
+// accountMember is the segment mode: the member is part of the account
+// name.
+func (d memberDimension) accountMember(account string) string {
+	segments := strings.Split(account, ":")
+	if d.Segment >= len(segments) {
+		return sharedMember
+	}
+	return knownMember(strings.TrimSpace(segments[d.Segment]))
+}
+
+// taggedMember is the tag mode: the member is the tag's value on the
+// posting or, failing that, on its transaction.
+func (d memberDimension) taggedMember(p posting) string {
+	for _, comment := range []string{p.postComment, p.comment} {
+		if m := d.tagRe.FindStringSubmatch(comment); m != nil {
+			return knownMember(strings.TrimSpace(m[1]))
+		}
+	}
+	return sharedMember
+}
+
+// postingMember returns the member of a posting from a print pass.
+func (d memberDimension) postingMember(p posting) string {
+	if d.Tag != "" {
+		return d.taggedMember(p)
+	}
+	return d.accountMember(p.account)
+}
+
+// splitByMember appends the member label to every sample of set. weights
+// returns how much each member contributed to a source account of the
+// sample; the sample is divided in proportion to them, so the members
+// always add up to what the report said, valued or not. Samples nobody
+// contributed to go to sharedMember.
+func splitByMember(set *sampleSet, weights func(source string, labels []string) map[string]float64) *sampleSet {
+	out := newSampleSet()
+	for _, s := range set.samples {
+		sources := set.sources[strings.Join(s.labels, "\xff")]
+		shares := map[string]float64{}
+		total := 0.0
+		for _, src := range sources {
+			for m, w := range weights(src, s.labels) {
+				shares[m] += w
+				total += w
+			}
+		}
+		if total == 0 {
+			shares, total = map[string]float64{sharedMember: 1}, 1
+		}
+		for m, w := range shares {
+			lvs := append(slices.Clone(s.labels), m)
+			value := s.value * w / total
+			if len(sources) == 0 {
+				out.add(value, lvs...)
+				continue
+			}
+			out.addFrom(sources[0], value, lvs...)
+			for _, src := range sources[1:] {
+				out.addFrom(src, 0, lvs...)
+			}
+		}
+	}
+	return out
+}
+
+func (d memberDimension) segmentWeights(source string, _ []string) map[string]float64 {
+	return map[string]float64{d.accountMember(source): 1}
+}
+
+// sumTagged runs a print pass over query and sums the postings by account,
+// currency and, with byMonth, month, and then by member.
+func (d memberDimension) sumTagged(into map[string]map[string]float64, collector string, query []string, byMonth bool) error {
+	postings, err := runPrint(collector, query...)
+	if err != nil {
+		return err
+	}
+	for _, p := range postings {
+		key := p.account + "\xff" + p.currency
+		if byMonth {
+			key += "\xff" + p.month()
+		}
+		if into[key] == nil {
+			into[key] = map[string]float64{}
+		}
+		into[key][d.taggedMember(p)] += p.amount
+	}
+	return nil
+}
+
+// memberBalances adds the member label to the expense balances. The
+// balance report knows nothing about tags, so tag mode needs a print pass
+// over the same accounts.
+func memberBalances(accounts *sampleSet) (*sampleSet, error) {
+	d := cfg.MemberDimension
+	if d.Tag == "" {
+		return splitByMember(accounts, d.segmentWeights), nil
+	}
+	tagged := map[string]map[string]float64{}
+	for _, t := range cfg.AccountTypes {
+		if t.Family != "expenses" {
+			continue
+		}
+		if err := d.sumTagged(tagged, "balances", strings.Fields(t.Query), false); err != nil {
+			return nil, err
+		}
+	}
+	return splitByMember(accounts, func(source string, labels []string) map[string]float64 {
+		return tagged[source+"\xff"+labels[1]]
+	}), nil
+}
+
+// memberMonthly adds the member label to ledger_expenses_monthly, like
+// memberBalances.
+func memberMonthly(monthly *sampleSet) (*sampleSet, error) {
+	d := cfg.MemberDimension
+	if d.Tag == "" {
+		return splitByMember(monthly, d.segmentWeights), nil
+	}
+	tagged := map[string]map[string]float64{}
+	if err := d.sumTagged(tagged, "monthly", familyQuery("expenses"), true); err != nil {
+		return nil, err
+	}
+	return splitByMember(monthly, func(source string, labels []string) map[string]float64 {
+		return tagged[source+"\xff"+labels[1]+"\xff"+labels[2]]
+	}), nil
+}
@@ -0,0 +1,103 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// alice tagged a posting to bob's food account; the transaction itself is
+// carol's.
+var bothConventions = posting{
+	account:     "expenses:bob:food",
+	comment:     "who:carol",
+	postComment: "who:alice",
+}
+
+func setMemberDimension(t *testing.T, v string, members ...string) {
+	t.Helper()
+	d, err := parseMemberDimension(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types, err := parseAccountTypes("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := cfg
+	t.Cleanup(func() { cfg = old })
+	cfg.MemberDimension, cfg.Members, cfg.AccountTypes = d, members, types
+}
+
+func TestPostingMemberMatchingBoth(t *testing.T) {
+	cases := []struct {
+		name      string
+		dimension string
+		members   []string
+		p         posting
+		want      string
+	}{
+		{"tag mode takes the posting tag", "who", nil, bothConventions, "alice"},
+		{"segment mode takes the account", "1", nil, bothConventions, "bob"},
+		{"tag mode falls back to the transaction tag", "who", nil, posting{account: "expenses:bob:food", comment: "who:carol"}, "carol"},
+		{"tag mode ignores the account", "who", nil, posting{account: "expenses:bob:food"}, sharedMember},
+		{"segment mode ignores tags", "1", nil, posting{account: "expenses", postComment: "who:alice"}, sharedMember},
+		{"unknown tag value", "who", []string{"bob"}, bothConventions, sharedMember},
+		{"unknown segment", "1", []string{"alice"}, bothConventions, sharedMember},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			setMemberDimension(t, c.dimension, c.members...)
+			if got := cfg.MemberDimension.postingMember(c.p); got != c.want {
+				t.Errorf("postingMember = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+// memberPrint has two postings to expenses:bob:food, one tagged for alice
+// and one for bob, which only tag mode tells apart.
+const memberPrint = `"txnidx","date","date2","status","code","description","comment","account","amount","commodity","credit","debit","posting-status","posting-comment"
+"1","2024-03-02","","","","Bakery","","expenses:bob:food","20","€","","20","","who:alice"
+"1","2024-03-02","","","","Bakery","","assets:bank","-20","€","20","","",""
+"2","2024-03-05","","","","Supermarket","who:alice","expenses:bob:food","10","€","","10","","who:bob"
+"2","2024-03-05","","","","Supermarket","who:alice","assets:bank","-10","€","10","","",""
+`
+
+func TestMemberBalancesMatchingBoth(t *testing.T) {
+	defer func(exec func(...string) ([]byte, []byte, error)) { hledgerExec = exec }(hledgerExec)
+	hledgerExec = func(args ...string) ([]byte, []byte, error) {
+		return []byte(memberPrint), nil, nil
+	}
+	balances := func() *sampleSet {
+		s := newSampleSet()
+		s.addFrom("expenses:bob:food", 30, "bob:food", "EUR")
+		return s
+	}
+
+	cases := []struct {
+		dimension string
+		want      map[string]float64
+	}{
+		{"who", map[string]float64{"alice": 20, "bob": 10}},
+		{"1", map[string]float64{"bob": 30}},
+	}
+	for _, c := range cases {
+		t.Run(c.dimension, func(t *testing.T) {
+			setMemberDimension(t, c.dimension)
+			got, err := memberBalances(balances())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.samples) != len(c.want) {
+				t.Errorf("got %d members, want %d", len(got.samples), len(c.want))
+			}
+			for member, want := range c.want {
+				if v, ok := got.get("bob:food", "EUR", member); !ok || math.Abs(v-want) > 1e-9 {
+					t.Errorf("member %s = %v, %v, want %v", member, v, ok, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,463 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	seriesCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ledger_exporter_series",
+			Help: "Number of series currently exported per metric",
+		},
+		[]string{"metric"},
+	)
+
+	seriesDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ledger_exporter_series_dropped_total",
+			Help: "Series dropped because a metric exceeded MAX_SERIES_PER_METRIC",
+		},
+		[]string{"metric"},
+	)
+
+	labelCollisions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ledger_exporter_label_collisions_total",
+			Help: "Series that distinct source accounts or payees started being summed into",
+		},
+		[]string{"metric"},
+	)
+
+	seriesGraceHeld = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ledger_exporter_series_grace_held",
+			Help: "Series missing from the last refresh that are still exported at their previous value",
+		},
+		[]string{"metric"},
+	)
+
+	// filteredAmount is a gauge per metric, not a counter: every refresh
+	// drops the same balances again, see the currency filter in README.md.
+	filteredAmount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ledger_exporter_filtered_amount",
+			Help: "Absolute sum of the series the last refresh left out of a metric because CURRENCIES or EXCLUDE_CURRENCIES filter their currency",
+		},
+		[]string{"metric", "currency"},
+	)
+
+	metricLastChange = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ledger_exporter_metric_last_change_timestamp_seconds",
+			Help: "When a refresh last changed any series of a metric, or the exporter started",
+		},
+		[]string{"metric"},
+	)
+)
+
+type sample struct {
+	labels []string
+	value  float64
+}
+
+// sampleSet accumulates the samples of one gaugeFamily during a collector
+// run. Nothing is visible to scrapes until the set is published.
+type sampleSet struct {
+	index   map[string]int
+	samples []sample
+	// sources are the distinct source keys added to each series with
+	// addFrom, to catch label collisions.
+	sources map[string][]string
+}
+
+func newSampleSet() *sampleSet {
+	return &sampleSet{index: map[string]int{}}
+}
+
+func (s *sampleSet) set(value float64, lvs ...string) {
+	key := strings.Join(lvs, "\xff")
+	if i, ok := s.index[key]; ok {
+		s.samples[i].value = value
+		return
+	}
+	s.index[key] = len(s.samples)
+	s.samples = append(s.samples, sample{labels: lvs, value: value})
+}
+
+func (s *sampleSet) get(lvs ...string) (float64, bool) {
+	i, ok := s.index[strings.Join(lvs, "\xff")]
+	if !ok {
+		return 0, false
+	}
+	return s.samples[i].value, true
+}
+
+func (s *sampleSet) add(value float64, lvs ...string) {
+	key := strings.Join(lvs, "\xff")
+	if i, ok := s.index[key]; ok {
+		s.samples[i].value += value
+		return
+	}
+	s.set(value, lvs...)
+}
+
+// addFrom adds value like add and remembers source, the account or payee
+// the labels were derived from. Different sources ending up with the same
+// labels are summed and reported as a collision on publish.
+func (s *sampleSet) addFrom(source string, value float64, lvs ...string) {
+	key := strings.Join(lvs, "\xff")
+	if s.sources == nil {
+		s.sources = map[string][]string{}
+	}
+	if !slices.Contains(s.sources[key], source) {
+		s.sources[key] = append(s.sources[key], source)
+	}
+	s.add(value, lvs...)
+}
+
+// merge adds all samples of other, keeping track of their sources.
+func (s *sampleSet) merge(other *sampleSet) {
+	for _, smp := range other.samples {
+		key := strings.Join(smp.labels, "\xff")
+		sources := other.sources[key]
+		if len(sources) == 0 {
+			s.add(smp.value, smp.labels...)
+			continue
+		}
+		s.addFrom(sources[0], smp.value, smp.labels...)
+		for _, src := range sources[1:] {
+			s.addFrom(src, 0, smp.labels...)
+		}
+	}
+}
+
+// filter returns the samples keep accepts the labels of.
+func (s *sampleSet) filter(keep func(lvs []string) bool) *sampleSet {
+	out := newSampleSet()
+	for _, smp := range s.samples {
+		if keep(smp.labels) {
+			out.set(smp.value, smp.labels...)
+		}
+	}
+	return out
+}
+
+// reportCollisions counts the series of set several sources went into that
+// weren't collisions in the previous publish, so a collision that persists
+// is counted once rather than every refresh. It logs only when the number
+// of collisions changes, listing the new ones.
+func (f *gaugeFamily) reportCollisions(set *sampleSet) {
+	keys := make([]string, 0, len(set.sources))
+	for key, sources := range set.sources {
+		if len(sources) > 1 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	f.mu.Lock()
+	previous := f.collided
+	f.collided = make(map[string]bool, len(keys))
+	for _, key := range keys {
+		f.collided[key] = true
+	}
+	f.mu.Unlock()
+	var added []string
+	for _, key := range keys {
+		if !previous[key] {
+			added = append(added, fmt.Sprintf("%q all map to {%s}",
+				set.sources[key], strings.ReplaceAll(key, "\xff", ", ")))
+		}
+	}
+	labelCollisions.WithLabelValues(f.name).Add(float64(len(added)))
+	if len(keys) == len(previous) {
+		return
+	}
+	log.Printf("%s: %d series sum several sources, was %d", f.name, len(keys), len(previous))
+	for _, a := range added {
+		log.Printf("%s: %s, summing them", f.name, a)
+	}
+}
+
+// gaugeFamily stands in for a GaugeVec whose series are rebuilt from
+// scratch on every refresh. Swapping the whole set at once means a scrape
+// never sees a half-reset vec, and gives one place to enforce limits.
+type gaugeFamily struct {
+	name   string
+	help   string
+	desc   *prometheus.Desc
+	labels []string
+	// period is the index of the "month" or "day" label, -1 if the family
+	// isn't bucketed by period.
+	period int
+	// currency is the index of the "currency" label, -1 without one.
+	currency int
+
+	mu      sync.RWMutex
+	samples []sample
+	// hash identifies the full sample set of the last publish.
+	hash      uint64
+	published bool
+	// missed counts the publishes a held series has been missing from,
+	// belowCap those a series kept by hysteresis has been below the cap.
+	missed, belowCap map[string]int
+	// collided holds the series keys that were collisions in the last
+	// publish.
+	collided map[string]bool
+	// filtered is the amount the last publish dropped per filtered
+	// currency.
+	filtered map[string]float64
+}
+
+func newGaugeFamily(opts prometheus.GaugeOpts, labels []string) *gaugeFamily {
+	f := &gaugeFamily{
+		name:     opts.Name,
+		help:     opts.Help,
+		desc:     prometheus.NewDesc(opts.Name, opts.Help, labels, nil),
+		labels:   labels,
+		period:   -1,
+		currency: -1,
+	}
+	for i, l := range labels {
+		switch l {
+		case "month", "day":
+			f.period = i
+		case "currency":
+			f.currency = i
+		}
+	}
+	return f
+}
+
+// addLabel appends a label that depends on the configuration. It must be
+// called before the family is registered or published to.
+func (f *gaugeFamily) addLabel(label string) {
+	if slices.Contains(f.labels, label) {
+		return
+	}
+	f.labels = append(slices.Clone(f.labels), label)
+	f.desc = prometheus.NewDesc(f.name, f.help, f.labels, nil)
+}
+
+func (f *gaugeFamily) Describe(ch chan<- *prometheus.Desc) {
+	ch <- f.desc
+}
+
+func (f *gaugeFamily) Collect(ch chan<- prometheus.Metric) {
+	if isStale() {
+		return
+	}
+	stamp := cfg.OpenMetricsTimestamps && f.period >= 0
+	now := clock()
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, s := range f.samples {
+		m := prometheus.MustNewConstMetric(f.desc, prometheus.GaugeValue, s.value, s.labels...)
+		if stamp {
+			if end, ok := periodEnd(f.labels[f.period], s.labels[f.period], now); ok {
+				m = prometheus.NewMetricWithTimestamp(end, m)
+			}
+		}
+		ch <- m
+	}
+}
+
+func (f *gaugeFamily) len() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.samples)
+}
+
+// snapshot returns the currently exported samples.
+func (f *gaugeFamily) snapshot() []sample {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return append([]sample(nil), f.samples...)
+}
+
+// periodEnd returns the last second of the month or day named by value.
+// Periods that haven't ended yet are stamped with now, since Prometheus
+// rejects samples from the future.
+func periodEnd(label, value string, now time.Time) (time.Time, bool) {
+	var end time.Time
+	switch label {
+	case "month":
+		start, err := time.ParseInLocation("2006-01", value, now.Location())
+		if err != nil {
+			return time.Time{}, false
+		}
+		end = start.AddDate(0, 1, 0).Add(-time.Second)
+	case "day":
+		start, err := time.ParseInLocation("2006-01-02", value, now.Location())
+		if err != nil {
+			return time.Time{}, false
+		}
+		end = start.AddDate(0, 0, 1).Add(-time.Second)
+	default:
+		return time.Time{}, false
+	}
+	if end.After(now) {
+		end = now
+	}
+	return end, true
+}
+
+// hash returns a fingerprint of the set that doesn't depend on the order
+// samples were added in.
+func (s *sampleSet) hash() uint64 {
+	keys := make([]string, 0, len(s.index))
+	for k := range s.index {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, k := range keys {
+		h.Write([]byte(k))
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(s.samples[s.index[k]].value))
+		h.Write(buf[:])
+	}
+	return h.Sum64()
+}
+
+// oldestRetainedMonth is the first month RETAIN_MONTHS keeps as of now,
+// "" when every month is kept.
+func oldestRetainedMonth(now time.Time) string {
+	if cfg.RetainMonths == 0 {
+		return ""
+	}
+	y, m, _ := now.Date()
+	return time.Date(y, m-time.Month(cfg.RetainMonths-1), 1, 0, 0, 0, 0, now.Location()).Format("2006-01")
+}
+
+// publish replaces the exported series with set, minus the samples in a
+// currency CURRENCIES or EXCLUDE_CURRENCIES filter and those of a month
+// before the RETAIN_MONTHS window. Series that vanished
+// since the last publish are held at their last value for
+// cfg.SeriesGraceCycles publishes, so a series missing for a single refresh
+// doesn't go stale and come back. When the set is larger than
+// cfg.MaxSeriesPerMetric only the series with the largest absolute values
+// are kept, see capSeries.
+func (f *gaugeFamily) publish(set *sampleSet) {
+	f.reportCollisions(set)
+	if f.currency >= 0 {
+		set = f.filterCurrencies(set)
+	}
+	// months and days are zero padded, so both compare with a month as
+	// strings
+	oldest := oldestRetainedMonth(clock())
+	windowed := oldest != "" && f.period >= 0
+	if windowed {
+		set = set.filter(func(lvs []string) bool { return lvs[f.period] >= oldest })
+	}
+
+	f.mu.Lock()
+	previous := f.samples
+	f.mu.Unlock()
+	if windowed {
+		// a month that left the window isn't missing
+		previous = slices.DeleteFunc(slices.Clone(previous), func(s sample) bool { return s.labels[f.period] < oldest })
+	}
+	held := f.holdMissing(set, previous)
+	seriesGraceHeld.WithLabelValues(f.name).Set(float64(held))
+
+	hash := set.hash()
+	samples := f.capSeries(set.samples, previous)
+
+	f.mu.Lock()
+	f.samples = samples
+	changed := !f.published || hash != f.hash
+	f.hash, f.published = hash, true
+	f.mu.Unlock()
+	if changed {
+		metricLastChange.WithLabelValues(f.name).SetToCurrentTime()
+	}
+	seriesCount.WithLabelValues(f.name).Set(float64(len(samples)))
+}
+
+// holdMissing adds the previous samples set lacks, unless they have been
+// missing for more than cfg.SeriesGraceCycles publishes, and returns how
+// many it added.
+func (f *gaugeFamily) holdMissing(set *sampleSet, previous []sample) int {
+	if cfg.SeriesGraceCycles <= 0 {
+		f.missed = nil
+		return 0
+	}
+	missed := map[string]int{}
+	for _, s := range previous {
+		key := strings.Join(s.labels, "\xff")
+		if _, ok := set.index[key]; ok {
+			continue
+		}
+		if n := f.missed[key] + 1; n <= cfg.SeriesGraceCycles {
+			missed[key] = n
+			set.set(s.value, s.labels...)
+		}
+	}
+	f.missed = missed
+	return len(missed)
+}
+
+// capSeries keeps the cfg.MaxSeriesPerMetric samples with the largest
+// absolute values. A series exported before is only evicted once it has
+// been below the cutoff for more than cfg.SeriesCapHysteresis publishes,
+// taking the place of the smallest newcomer meanwhile, so series right at
+// the cutoff don't flap.
+func (f *gaugeFamily) capSeries(samples, previous []sample) []sample {
+	limit := cfg.MaxSeriesPerMetric
+	if limit <= 0 || len(samples) <= limit {
+		f.belowCap = nil
+		return samples
+	}
+	// sorted as a copy: samples backs the index of the caller's sampleSet
+	samples = slices.Clone(samples)
+	sort.SliceStable(samples, func(i, j int) bool {
+		return math.Abs(samples[i].value) > math.Abs(samples[j].value)
+	})
+	incumbent := make(map[string]bool, len(previous))
+	for _, s := range previous {
+		incumbent[strings.Join(s.labels, "\xff")] = true
+	}
+	below := map[string]int{}
+	kept, rest := samples[:limit], samples[limit:]
+	newcomer := len(kept) - 1
+	for i, s := range rest {
+		key := strings.Join(s.labels, "\xff")
+		if !incumbent[key] {
+			continue
+		}
+		n := f.belowCap[key] + 1
+		if n > cfg.SeriesCapHysteresis {
+			continue
+		}
+		for newcomer >= 0 && incumbent[strings.Join(kept[newcomer].labels, "\xff")] {
+			newcomer--
+		}
+		if newcomer < 0 {
+			break
+		}
+		kept[newcomer], rest[i] = rest[i], kept[newcomer]
+		newcomer--
+		below[key] = n
+	}
+	f.belowCap = below
+
+	dropped := len(rest)
+	log.Printf("%s: %d series exceed the limit of %d, dropping %d", f.name, len(samples), limit, dropped)
+	seriesDropped.WithLabelValues(f.name).Add(float64(dropped))
+	return kept
+}
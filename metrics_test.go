@@ -0,0 +1,163 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestReportCollisions(t *testing.T) {
+	f := newGaugeFamily(prometheus.GaugeOpts{Name: "test_collisions", Help: "test"}, []string{"payee", "currency"})
+	var logged bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logged)
+
+	publish := func(sources ...string) {
+		logged.Reset()
+		set := newSampleSet()
+		for _, source := range sources {
+			set.addFrom(source, 1, "amazon", "EUR")
+		}
+		f.publish(set)
+	}
+	collisions := func() float64 {
+		var m dto.Metric
+		if err := labelCollisions.WithLabelValues(f.name).Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		return m.GetCounter().GetValue()
+	}
+
+	publish("Amazon (order 1)", "Amazon (order 2)")
+	if got := collisions(); got != 1 {
+		t.Errorf("collisions after first refresh = %v, want 1", got)
+	}
+	if !strings.Contains(logged.String(), "Amazon (order 2)") {
+		t.Errorf("a new collision wasn't logged: %q", logged.String())
+	}
+
+	publish("Amazon (order 1)", "Amazon (order 2)")
+	if got := collisions(); got != 1 {
+		t.Errorf("a persisting collision was counted again: %v", got)
+	}
+	if logged.Len() > 0 {
+		t.Errorf("a steady refresh logged %q", logged.String())
+	}
+
+	publish("Amazon (order 1)")
+	if got := collisions(); got != 1 {
+		t.Errorf("collisions after the sources diverged = %v, want still 1", got)
+	}
+	if !strings.Contains(logged.String(), "0 series") {
+		t.Errorf("the change to no collisions wasn't logged: %q", logged.String())
+	}
+
+	publish("Amazon (order 1)", "Amazon (order 3)")
+	if got := collisions(); got != 2 {
+		t.Errorf("a collision coming back wasn't counted: %v", got)
+	}
+}
+
+func TestRetainMonths(t *testing.T) {
+	defer func(months int) { cfg.RetainMonths = months }(cfg.RetainMonths)
+	cfg.RetainMonths = 3
+	defer func(previous func() time.Time) { clock = previous }(clock)
+	now := time.Date(2025, 5, 20, 12, 0, 0, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	if got := oldestRetainedMonth(now); got != "2025-03" {
+		t.Fatalf("oldestRetainedMonth = %q, want 2025-03", got)
+	}
+
+	f := newGaugeFamily(prometheus.GaugeOpts{Name: "test_retained", Help: "test"}, []string{"category", "month"})
+	set := newSampleSet()
+	for _, month := range []string{"2024-12", "2025-02", "2025-03", "2025-05"} {
+		set.set(1, "food", month)
+	}
+	f.publish(set)
+	for month, want := range map[string]bool{"2024-12": false, "2025-02": false, "2025-03": true, "2025-05": true} {
+		if _, ok := published(f, "food", month); ok != want {
+			t.Errorf("month %s published = %v, want %v", month, ok, want)
+		}
+	}
+
+	name, help, label, month, value := "test_retained", "test", "month", "2025-01", 1.0
+	families := []*dto.MetricFamily{{
+		Name: &name,
+		Help: &help,
+		Type: dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{
+			Label: []*dto.LabelPair{{Name: &label, Value: &month}},
+			Gauge: &dto.Gauge{Value: &value},
+		}},
+	}}
+	if errs := checkInvariants(families, now); len(errs) != 1 || !strings.Contains(errs[0].Error(), "RETAIN_MONTHS") {
+		t.Errorf("checkInvariants = %v, want a RETAIN_MONTHS violation", errs)
+	}
+}
+
+func TestCapSeriesKeepsSetIndex(t *testing.T) {
+	defer func(limit int) { cfg.MaxSeriesPerMetric = limit }(cfg.MaxSeriesPerMetric)
+	cfg.MaxSeriesPerMetric = 2
+	f := newGaugeFamily(prometheus.GaugeOpts{Name: "test_capped", Help: "test"}, []string{"category"})
+	set := newSampleSet()
+	for i, category := range []string{"books", "food", "rent", "travel"} {
+		set.set(float64(i+1), category)
+	}
+	f.publish(set)
+
+	for i, category := range []string{"books", "food", "rent", "travel"} {
+		if v, ok := set.get(category); !ok || v != float64(i+1) {
+			t.Errorf("after publish %s = %v, %v, want %d", category, v, ok, i+1)
+		}
+	}
+	for _, category := range []string{"rent", "travel"} {
+		if _, ok := published(f, category); !ok {
+			t.Errorf("%s was dropped, want the two largest kept", category)
+		}
+	}
+	if f.len() != 2 {
+		t.Errorf("published %d series, want 2", f.len())
+	}
+}
+
+func TestConsistencyDropsOnlyGoneCurrencies(t *testing.T) {
+	accounts, totals := newSampleSet(), newSampleSet()
+	accounts.set(10, "bank", "EUR")
+	accounts.set(5, "cash", "USD")
+	totals.set(10, "EUR")
+	totals.set(4, "USD")
+	checkConsistency("test_consistency", accounts, totals)
+
+	accounts, totals = newSampleSet(), newSampleSet()
+	accounts.set(12, "bank", "EUR")
+	totals.set(12, "EUR")
+	checkConsistency("test_consistency", accounts, totals)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(consistencyError)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var currencies []string
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			if labelValue(m, "family") == "test_consistency" {
+				currencies = append(currencies, labelValue(m, "currency"))
+			}
+		}
+	}
+	if !slices.Equal(currencies, []string{"EUR"}) {
+		t.Errorf("currencies after USD went away = %v, want [EUR]", currencies)
+	}
+}
@@ -0,0 +1,101 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ledgerExpensesMTD = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_expenses_mtd",
+			Help: "Expenses of the current month up to and including today",
+		},
+		[]string{"category", "currency"},
+	)
+
+	ledgerExpensesMTDLastMonth = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_expenses_mtd_last_month",
+			Help: "Expenses of the previous month up to and including the same day of the month",
+		},
+		[]string{"category", "currency"},
+	)
+
+	ledgerExpensesMTDRatio = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_expenses_mtd_ratio",
+			Help: "ledger_expenses_mtd divided by ledger_expenses_mtd_last_month, absent when last month is zero",
+		},
+		[]string{"category", "currency"},
+	)
+)
+
+// mtdRanges returns the [begin, end) dates of this month so far and of the
+// same stretch of the previous month. The day is clamped to the length of
+// the previous month, so March 30 compares against all of February.
+func mtdRanges(today time.Time) (thisBegin, thisEnd, lastBegin, lastEnd time.Time) {
+	y, m, d := today.Date()
+	loc := today.Location()
+	thisBegin = time.Date(y, m, 1, 0, 0, 0, 0, loc)
+	thisEnd = time.Date(y, m, d, 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+
+	lastBegin = thisBegin.AddDate(0, -1, 0)
+	daysInLast := thisBegin.AddDate(0, 0, -1).Day()
+	lastEnd = lastBegin.AddDate(0, 0, min(d, daysInLast))
+	return
+}
+
+// balanceBetween runs a flat balance report of the accounts of family
+// for the [begin, end) dates on behalf of collector, valued like the
+// balances so both sides of a comparison agree with ledger_expenses.
+func balanceBetween(collector, family string, begin, end time.Time) (accounts, totals *sampleSet, err error) {
+	args := append([]string{"-s", "bal", "--depth", "5", "--no-elide",
+		"--begin", begin.Format("2006-01-02"), "--end", end.Format("2006-01-02")}, valuationArgs()...)
+	args = append(append(args, "--"), familyQuery(family)...)
+	out, err := runHledger(collector, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("hledger bal %s %s..%s: %w", family, begin.Format("2006-01-02"), end.Format("2006-01-02"), err)
+	}
+	accounts, totals = parseBalanceReport(out, func(account string) (string, bool) {
+		return familyLabel(family, account)
+	})
+	return accounts, totals, nil
+}
+
+func expensesBetween(collector string, begin, end time.Time) (*sampleSet, error) {
+	accounts, _, err := balanceBetween(collector, "expenses", begin, end)
+	return accounts, err
+}
+
+// collectMonthToDate compares this month's spending so far with the same
+// number of days of last month. "Today" is the local date of the exporter,
+// so set TZ to your own time zone.
+func collectMonthToDate() error {
+	log.Println("collectMonthToDate called")
+	thisBegin, thisEnd, lastBegin, lastEnd := mtdRanges(clock())
+	current, err := expensesBetween("mtd", thisBegin, thisEnd)
+	if err != nil {
+		return err
+	}
+	previous, err := expensesBetween("mtd", lastBegin, lastEnd)
+	if err != nil {
+		return err
+	}
+
+	ratios := newSampleSet()
+	for _, s := range current.samples {
+		if last, ok := previous.get(s.labels...); ok && last != 0 {
+			ratios.set(s.value/last, s.labels...)
+		}
+	}
+	ledgerExpensesMTD.publish(current)
+	ledgerExpensesMTDLastMonth.publish(previous)
+	ledgerExpensesMTDRatio.publish(ratios)
+	return nil
+}
@@ -0,0 +1,84 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMTDRanges(t *testing.T) {
+	cases := []struct {
+		today                                  string
+		thisBegin, thisEnd, lastBegin, lastEnd string
+	}{
+		{"2024-03-15", "2024-03-01", "2024-03-16", "2024-02-01", "2024-02-16"},
+		// clamped to all of February, leap year or not
+		{"2024-03-30", "2024-03-01", "2024-03-31", "2024-02-01", "2024-03-01"},
+		{"2024-03-31", "2024-03-01", "2024-04-01", "2024-02-01", "2024-03-01"},
+		{"2023-03-29", "2023-03-01", "2023-03-30", "2023-02-01", "2023-03-01"},
+		{"2024-05-31", "2024-05-01", "2024-06-01", "2024-04-01", "2024-05-01"},
+		// January compares against December of the year before
+		{"2024-01-01", "2024-01-01", "2024-01-02", "2023-12-01", "2023-12-02"},
+	}
+	for _, tc := range cases {
+		today, _ := time.Parse("2006-01-02", tc.today)
+		thisBegin, thisEnd, lastBegin, lastEnd := mtdRanges(today.Add(18 * time.Hour))
+		got := [4]string{}
+		for i, d := range []time.Time{thisBegin, thisEnd, lastBegin, lastEnd} {
+			got[i] = d.Format("2006-01-02")
+		}
+		if want := [4]string{tc.thisBegin, tc.thisEnd, tc.lastBegin, tc.lastEnd}; got != want {
+			t.Errorf("%s: got %v, want %v", tc.today, got, want)
+		}
+	}
+}
+
+func TestMTDRangesTimeZone(t *testing.T) {
+	auckland, err := time.LoadLocation("Pacific/Auckland")
+	if err != nil {
+		t.Skip(err)
+	}
+	// late on March 31 in UTC is already April 1 in Auckland
+	now := time.Date(2024, 3, 31, 20, 0, 0, 0, time.UTC)
+	thisBegin, thisEnd, _, _ := mtdRanges(now.In(auckland))
+	if thisBegin.Format("2006-01-02") != "2024-04-01" || thisEnd.Format("2006-01-02") != "2024-04-02" {
+		t.Errorf("in Auckland: %s..%s, want 2024-04-01..2024-04-02", thisBegin, thisEnd)
+	}
+	if thisBegin.Location() != auckland {
+		t.Errorf("ranges are in %s, want the local time zone", thisBegin.Location())
+	}
+	thisBegin, _, _, _ = mtdRanges(now)
+	if thisBegin.Format("2006-01-02") != "2024-03-01" {
+		t.Errorf("in UTC: month starts %s, want 2024-03-01", thisBegin)
+	}
+
+	// the day a DST change happens on still counts as one day
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	_, thisEnd, _, _ = mtdRanges(time.Date(2024, 3, 31, 12, 0, 0, 0, berlin))
+	if thisEnd.Format("2006-01-02 15:04") != "2024-04-01 00:00" {
+		t.Errorf("after the DST change: end %s", thisEnd)
+	}
+}
+
+func TestMonthToDateIsValued(t *testing.T) {
+	defer func(exec func(...string) ([]byte, []byte, error)) { hledgerExec = exec }(hledgerExec)
+	var valued int
+	hledgerExec = func(args ...string) ([]byte, []byte, error) {
+		if i := slices.Index(args, "--value"); i >= 0 && args[i+1] == "end,$" {
+			valued++
+		}
+		return []byte("             $12.00  expenses:food\n--------------------\n             $12.00\n"), nil, nil
+	}
+	setValuation(t, "end", false)
+	if err := collectMonthToDate(); err != nil {
+		t.Fatal(err)
+	}
+	if valued != 2 {
+		t.Errorf("%d of 2 reports valued, want both like ledger_expenses", valued)
+	}
+}
@@ -0,0 +1,36 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// OTLP export lives in otlp_sdk.go, built with -tags otlp, as it needs the
+// OpenTelemetry SDK; otlp_disabled.go stands in for it otherwise.
+
+var otlpExports = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "ledger_exporter_otlp_exports_total",
+		Help: "OTLP exports after a refresh by result, success or failure after all retries",
+	},
+	[]string{"result"},
+)
+
+var (
+	// otlpPending holds at most one export request; a refresh finishing
+	// while an export is still running doesn't queue up another.
+	otlpPending = make(chan struct{}, 1)
+)
+
+// requestOTLPPush asks the exporter started by startOTLP to export the
+// metrics as they are now.
+func requestOTLPPush() {
+	if cfg.OTLPEndpoint == "" {
+		return
+	}
+	select {
+	case otlpPending <- struct{}{}:
+	default:
+	}
+}
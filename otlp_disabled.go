@@ -0,0 +1,18 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+
+//go:build !otlp
+
+package main
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// startOTLP refuses OTLP_ENDPOINT in a build without the OpenTelemetry SDK,
+// rather than silently exporting nothing.
+func startOTLP(prometheus.Gatherer) error {
+	return errors.New("this exporter was built without OTLP support, rebuild it with -tags otlp")
+}
@@ -0,0 +1,242 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+
+//go:build otlp
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"google.golang.org/grpc/credentials"
+)
+
+// otlpTimeout bounds one export, retries included.
+const otlpTimeout = 30 * time.Second
+
+// otlpPusher mirrors what the registry gathers into OpenTelemetry
+// instruments: every gathered family becomes an asynchronous instrument
+// whose callback observes the series of the last gather.
+type otlpPusher struct {
+	g        prometheus.Gatherer
+	meter    metric.Meter
+	reader   *sdkmetric.ManualReader
+	exporter *otlpmetricgrpc.Exporter
+
+	mu     sync.Mutex
+	latest map[string]*dto.MetricFamily
+	// instruments holds the families an instrument was created for.
+	instruments map[string]bool
+}
+
+// startOTLP exports everything g gathers to cfg.OTLPEndpoint over
+// OTLP/gRPC whenever a refresh asks for it. Exports run in their own
+// goroutine, so a slow or failing collector never holds up a refresh or
+// /metrics.
+func startOTLP(g prometheus.Gatherer) error {
+	opts, err := otlpOptions(cfg.OTLPEndpoint)
+	if err != nil {
+		return err
+	}
+	exporter, err := otlpmetricgrpc.New(context.Background(), opts...)
+	if err != nil {
+		return err
+	}
+	reader := sdkmetric.NewManualReader(
+		sdkmetric.WithTemporalitySelector(exporter.Temporality),
+		sdkmetric.WithAggregationSelector(exporter.Aggregation),
+	)
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithResource(otlpResource()))
+	p := &otlpPusher{
+		g:           g,
+		meter:       provider.Meter("ledger_exporter"),
+		reader:      reader,
+		exporter:    exporter,
+		instruments: map[string]bool{},
+	}
+	go func() {
+		for range otlpPending {
+			if err := p.push(); err != nil {
+				otlpExports.WithLabelValues("failure").Inc()
+				log.Printf("otlp export: %v", err)
+				continue
+			}
+			otlpExports.WithLabelValues("success").Inc()
+		}
+	}()
+	return nil
+}
+
+// otlpOptions configures the gRPC exporter: an http:// endpoint is
+// plaintext, an https:// one uses TLS with OTLP_CA_FILE and
+// OTLP_CLIENT_CERT. Failed exports are retried with backoff.
+func otlpOptions(endpoint string) ([]otlpmetricgrpc.Option, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an http or https url", endpoint)
+	}
+	opts := []otlpmetricgrpc.Option{
+		otlpmetricgrpc.WithEndpointURL(endpoint),
+		otlpmetricgrpc.WithHeaders(cfg.OTLPHeaders),
+		otlpmetricgrpc.WithTimeout(otlpTimeout),
+		otlpmetricgrpc.WithRetry(otlpmetricgrpc.RetryConfig{
+			Enabled:         true,
+			InitialInterval: time.Second,
+			MaxInterval:     10 * time.Second,
+			MaxElapsedTime:  otlpTimeout,
+		}),
+	}
+	if u.Scheme == "https" {
+		tlsConfig, err := otlpTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+	}
+	return opts, nil
+}
+
+func otlpTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if cfg.OTLPCAFile != "" {
+		pem, err := os.ReadFile(cfg.OTLPCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", cfg.OTLPCAFile)
+		}
+	}
+	if cfg.OTLPClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.OTLPClientCert, cfg.OTLPClientKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// otlpResource names the exporter, its version and the journal it reads.
+func otlpResource() *resource.Resource {
+	attrs := []attribute.KeyValue{
+		attribute.String("service.name", "ledger_exporter"),
+		attribute.String("service.version", exporterVersion()),
+	}
+	if cfg.GiteaJournalURL != "" {
+		attrs = append(attrs, attribute.String("ledger.journal", path.Base(cfg.GiteaJournalURL)))
+	}
+	return resource.NewSchemaless(attrs...)
+}
+
+// exporterVersion is the module version the binary was built from.
+func exporterVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Version
+	}
+	return "unknown"
+}
+
+// push gathers, creates instruments for families seen for the first time,
+// and has the reader collect and the exporter send one snapshot.
+func (p *otlpPusher) push() error {
+	families, err := p.g.Gather()
+	if err != nil && len(families) == 0 {
+		return fmt.Errorf("gathering: %w", err)
+	}
+	latest := make(map[string]*dto.MetricFamily, len(families))
+	for _, mf := range families {
+		latest[mf.GetName()] = mf
+	}
+	p.mu.Lock()
+	p.latest = latest
+	p.mu.Unlock()
+	for _, mf := range families {
+		if err := p.instrument(mf); err != nil {
+			log.Printf("otlp: %s: %v", mf.GetName(), err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), otlpTimeout)
+	defer cancel()
+	var rm metricdata.ResourceMetrics
+	if err := p.reader.Collect(ctx, &rm); err != nil {
+		return fmt.Errorf("collecting: %w", err)
+	}
+	return p.exporter.Export(ctx, &rm)
+}
+
+// instrument maps a family onto an asynchronous instrument once: gauges
+// and untyped metrics to gauges, counters to cumulative sums. The SDK has
+// no asynchronous histogram, so histograms aren't exported.
+func (p *otlpPusher) instrument(mf *dto.MetricFamily) error {
+	name := mf.GetName()
+	if p.instruments[name] {
+		return nil
+	}
+	var err error
+	switch mf.GetType() {
+	case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+		_, err = p.meter.Float64ObservableGauge(name,
+			metric.WithDescription(mf.GetHelp()), metric.WithFloat64Callback(p.observe(name)))
+	case dto.MetricType_COUNTER:
+		_, err = p.meter.Float64ObservableCounter(name,
+			metric.WithDescription(mf.GetHelp()), metric.WithFloat64Callback(p.observe(name)))
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	p.instruments[name] = true
+	return nil
+}
+
+// observe reports the series of family name from the last gather, labels
+// as attributes.
+func (p *otlpPusher) observe(name string) metric.Float64Callback {
+	return func(_ context.Context, o metric.Float64Observer) error {
+		p.mu.Lock()
+		mf := p.latest[name]
+		p.mu.Unlock()
+		for _, m := range mf.GetMetric() {
+			attrs := make([]attribute.KeyValue, 0, len(m.GetLabel()))
+			for _, l := range m.GetLabel() {
+				attrs = append(attrs, attribute.String(l.GetName(), l.GetValue()))
+			}
+			var v float64
+			switch {
+			case m.Gauge != nil:
+				v = m.GetGauge().GetValue()
+			case m.Counter != nil:
+				v = m.GetCounter().GetValue()
+			default:
+				v = m.GetUntyped().GetValue()
+			}
+			o.Observe(v, metric.WithAttributes(attrs...))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,87 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+
+//go:build otlp
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestOTLPOptions(t *testing.T) {
+	for endpoint, ok := range map[string]bool{
+		"http://collector:4317":  true,
+		"https://collector:4317": true,
+		"collector:4317":         false,
+		"grpc://collector:4317":  false,
+		"http://":                false,
+	} {
+		if _, err := otlpOptions(endpoint); (err == nil) != ok {
+			t.Errorf("%s: err = %v, want ok %v", endpoint, err, ok)
+		}
+	}
+}
+
+// TestOTLPInstruments maps gauges and counters onto instruments, with the
+// labels as attributes, and leaves histograms out.
+func TestOTLPInstruments(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_gauge", Help: "test"}, []string{"currency"})
+	gauge.WithLabelValues("EUR").Set(12.5)
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "test"})
+	counter.Add(3)
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_seconds", Help: "test"})
+	histogram.Observe(1)
+	reg.MustRegister(gauge, counter, histogram)
+
+	reader := sdkmetric.NewManualReader()
+	p := &otlpPusher{
+		g:           reg,
+		meter:       sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test"),
+		reader:      reader,
+		instruments: map[string]bool{},
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.latest = map[string]*dto.MetricFamily{}
+	for _, mf := range families {
+		p.latest[mf.GetName()] = mf
+		if err := p.instrument(mf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			got[m.Name] = m.Data
+		}
+	}
+	if len(got) != 2 {
+		t.Errorf("exported %d instruments, want the gauge and the counter", len(got))
+	}
+	g, ok := got["test_gauge"].(metricdata.Gauge[float64])
+	if !ok || len(g.DataPoints) != 1 || g.DataPoints[0].Value != 12.5 {
+		t.Fatalf("test_gauge = %#v, want one point of 12.5", got["test_gauge"])
+	}
+	if v, _ := g.DataPoints[0].Attributes.Value("currency"); v.AsString() != "EUR" {
+		t.Errorf("test_gauge currency = %q, want EUR", v.AsString())
+	}
+	s, ok := got["test_total"].(metricdata.Sum[float64])
+	if !ok || !s.IsMonotonic || len(s.DataPoints) != 1 || s.DataPoints[0].Value != 3 {
+		t.Errorf("test_total = %#v, want a monotonic sum of 3", got["test_total"])
+	}
+}
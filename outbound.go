@@ -0,0 +1,166 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxRetryAfter is how often a request answered with 429 is retried.
+const maxRetryAfter = 3
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ledger_exporter_http_requests_total",
+			Help: "Outbound HTTP requests by host and status code, \"error\" when no response arrived",
+		},
+		[]string{"host", "code"},
+	)
+
+	httpRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "ledger_exporter_http_request_duration_seconds",
+			Help:    "Duration of outbound HTTP requests by host",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"host"},
+	)
+
+	httpThrottled = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ledger_exporter_http_throttled_total",
+			Help: "Outbound HTTP requests answered with 429 by host and whether they were \"retried\" or \"gave_up\"",
+		},
+		[]string{"host", "outcome"},
+	)
+)
+
+// instrumentedTransport counts and times every outbound round trip.
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func (t instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	httpRequestDuration.WithLabelValues(req.URL.Host).Observe(time.Since(start).Seconds())
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	httpRequestsTotal.WithLabelValues(req.URL.Host, code).Inc()
+	return resp, err
+}
+
+// tokenBucket spaces out requests to cfg.OutboundRateLimit per second
+// with bursts of cfg.OutboundBurst. A 429 pauses it for everybody until
+// the server's Retry-After has passed.
+type tokenBucket struct {
+	mu           sync.Mutex
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+}
+
+// outboundLimiter is shared by everything that talks to Gitea.
+var outboundLimiter tokenBucket
+
+// wait blocks until a request may go out.
+func (b *tokenBucket) wait(req *http.Request) error {
+	for {
+		delay := b.reserve()
+		if delay <= 0 {
+			return nil
+		}
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return req.Context().Err()
+		}
+	}
+}
+
+// reserve takes a token and returns 0, or returns how long to wait before
+// trying again.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if now.Before(b.blockedUntil) {
+		return b.blockedUntil.Sub(now)
+	}
+	rate, burst := cfg.OutboundRateLimit, float64(max(cfg.OutboundBurst, 1))
+	if rate <= 0 {
+		return 0
+	}
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+func (b *tokenBucket) block(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until := time.Now().Add(d); until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+}
+
+// retryAfter reads a Retry-After header given in seconds or as a date.
+func retryAfter(h string) (time.Duration, bool) {
+	if secs, err := strconv.Atoi(h); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// doOutbound sends req through the shared rate limiter. A 429 with a
+// Retry-After is waited out and retried rather than failing the fetch,
+// unless the wait is longer than cfg.RefreshInterval: the next refresh
+// would come around before then, so the 429 is returned to fail this one.
+// The client timeout applies to each attempt, not to the waiting.
+// Only requests without a body may be passed, so they can be resent.
+func doOutbound(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	for attempt := 0; ; attempt++ {
+		if err := outboundLimiter.wait(req); err != nil {
+			return nil, err
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+			return resp, err
+		}
+		d, ok := retryAfter(resp.Header.Get("Retry-After"))
+		if !ok || attempt == maxRetryAfter {
+			httpThrottled.WithLabelValues(host, "gave_up").Inc()
+			return resp, nil
+		}
+		if d > cfg.RefreshInterval {
+			log.Printf("%s rate limited us for %s, longer than REFRESH_INTERVAL, giving up", host, d)
+			httpThrottled.WithLabelValues(host, "gave_up").Inc()
+			return resp, nil
+		}
+		resp.Body.Close()
+		httpThrottled.WithLabelValues(host, "retried").Inc()
+		log.Printf("%s rate limited us, retrying in %s", host, d)
+		outboundLimiter.block(d)
+	}
+}
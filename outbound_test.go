@@ -0,0 +1,63 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRetryAfterCappedAtRefreshInterval(t *testing.T) {
+	requests := 0
+	retryIn := "3600"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", retryIn)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	defer func(c config) { cfg = c }(cfg)
+	cfg.RefreshInterval = time.Minute
+	cfg.OutboundRateLimit = 0
+	u, _ := url.Parse(srv.URL)
+	gaveUp := httpThrottled.WithLabelValues(u.Host, "gave_up")
+	retried := httpThrottled.WithLabelValues(u.Host, "retried")
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	start := time.Now()
+	resp, err := doOutbound(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || requests != 1 {
+		t.Errorf("an hour's Retry-After: got %s after %d requests, want the 429 after 1", resp.Status, requests)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("waited %s for a Retry-After past REFRESH_INTERVAL", time.Since(start))
+	}
+	if got := counterValue(t, gaveUp); got != 1 {
+		t.Errorf("gave_up = %v, want 1", got)
+	}
+
+	requests, retryIn = 0, "0"
+	req, _ = http.NewRequest("GET", srv.URL, nil)
+	if resp, err = doOutbound(req); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || requests != 2 {
+		t.Errorf("an immediate Retry-After: got %s after %d requests, want 200 after 2", resp.Status, requests)
+	}
+	if got := counterValue(t, retried); got != 1 {
+		t.Errorf("retried = %v, want 1", got)
+	}
+}
@@ -0,0 +1,214 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ledgerCommodityPriceTimestamp = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_commodity_price_timestamp_seconds",
+			Help: "Date of the newest price directive per held commodity and price unit",
+		},
+		[]string{"commodity", "unit"},
+	)
+
+	ledgerCommodityPriceMissing = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_commodity_price_missing",
+			Help: "1 if a held commodity has no price in VALUATION_CURRENCY, 0 otherwise",
+		},
+		[]string{"commodity"},
+	)
+)
+
+// currencyCode maps the currency symbols used in the journal to codes and
+// leaves anything else as written.
+func currencyCode(commodity string) string {
+	if code, ok := map[string]string{"€": "EUR", "$": "USD"}[commodity]; ok {
+		return code
+	}
+	return commodity
+}
+
+// marketPrice is one line of `hledger prices`.
+type marketPrice struct {
+	date      time.Time
+	commodity string
+	unit      string // "" for a bare number, e.g. an index
+	value     float64
+}
+
+// parsePriceLine reads lines like
+//
+//	P 2024-01-05 AAPL 180.00 USD
+//	P 2024-01-05 "VANG 500" €412,10
+//
+// where the unit is whatever symbol the price amount carries.
+func parsePriceLine(line string) (marketPrice, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), "P ")
+	if !ok {
+		return marketPrice{}, fmt.Errorf("not a price directive")
+	}
+	dateStr, rest, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	date, err := time.Parse("2006-01-02", dateStr)
+	if err != nil {
+		return marketPrice{}, err
+	}
+	rest = strings.TrimSpace(rest)
+	var commodity string
+	if strings.HasPrefix(rest, `"`) {
+		end := strings.Index(rest[1:], `"`)
+		if end < 0 {
+			return marketPrice{}, fmt.Errorf("unterminated commodity")
+		}
+		commodity, rest = rest[1:end+1], rest[end+2:]
+	} else {
+		commodity, rest, _ = strings.Cut(rest, " ")
+	}
+	rest = strings.TrimSpace(rest)
+	unit := strings.Trim(rest, `0123456789.,+- "`)
+	if commodity == "" {
+		return marketPrice{}, fmt.Errorf("missing commodity")
+	}
+	value, err := parsePriceAmount(strings.Trim(strings.Replace(rest, unit, "", 1), `" `))
+	if err != nil {
+		return marketPrice{}, err
+	}
+	return marketPrice{date: date, commodity: commodity, unit: unit, value: value}, nil
+}
+
+// parsePriceAmount reads a price in the commodity's own display style,
+// which may use a decimal comma. With both marks present the last one is
+// the decimal mark; a lone comma is one unless exactly three digits follow
+// it, which hledger would print as a thousands separator.
+func parsePriceAmount(s string) (float64, error) {
+	comma, dot := strings.LastIndex(s, ","), strings.LastIndex(s, ".")
+	decimalComma := comma > dot && (dot >= 0 || strings.Count(s, ",") == 1 && len(s)-comma-1 != 3)
+	if decimalComma {
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	return parseAmount(s)
+}
+
+// heldCommodities returns the commodities with a non-zero balance in any
+// asset account.
+func heldCommodities() (map[string]bool, error) {
+	args := append([]string{"bal", "--layout", "bare", "--output-format", "csv", "--"}, familyQuery("assets")...)
+	out, err := runHledger("prices", args...)
+	if err != nil {
+		return nil, fmt.Errorf("hledger bal: %w", err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading csv: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	cols := csvColumns(records[0])
+	accountCol, okAccount := cols["account"]
+	commodityCol, okCommodity := cols["commodity"]
+	balanceCol, okBalance := cols["balance"]
+	if !okAccount || !okCommodity || !okBalance {
+		return nil, fmt.Errorf("unexpected balance report header %q", records[0])
+	}
+
+	held := map[string]bool{}
+	for _, rec := range records[1:] {
+		if len(rec) != len(records[0]) || !inFamily("assets", strings.TrimSpace(rec[accountCol])) {
+			// the total row
+			continue
+		}
+		amount, err := parseAmount(strings.TrimSpace(rec[balanceCol]))
+		if err != nil {
+			warnf("could not parse balance %q: %v", rec[balanceCol], err)
+			continue
+		}
+		if amount != 0 {
+			held[strings.TrimSpace(rec[commodityCol])] = true
+		}
+	}
+	return held, nil
+}
+
+// collectPriceStaleness reports, for every held commodity other than the
+// valuation currency, how old its newest price is. Price directives dated
+// in the future don't apply yet and are ignored.
+func collectPriceStaleness() error {
+	log.Println("collectPriceStaleness called")
+	held, err := heldCommodities()
+	if err != nil {
+		return err
+	}
+	args := []string{"prices"}
+	if cfg.InferMarketPrices {
+		// count the prices of transactions like valuation does
+		args = append(args, "--infer-market-prices")
+	}
+	out, err := runHledger("prices", args...)
+	if err != nil {
+		return fmt.Errorf("hledger prices: %w", err)
+	}
+
+	target := currencyCode(cfg.ValuationCurrency)
+	now := clock()
+	type key struct{ commodity, unit string }
+	newest := map[key]time.Time{}
+	valued := map[string]bool{}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		p, err := parsePriceLine(sc.Text())
+		if err != nil {
+			warnf("could not parse price %q: %v", sc.Text(), err)
+			continue
+		}
+		if !held[p.commodity] || p.unit == "" || p.date.After(now) {
+			continue
+		}
+		k := key{p.commodity, currencyCode(p.unit)}
+		if p.date.After(newest[k]) {
+			newest[k] = p.date
+		}
+		if k.unit == target {
+			valued[p.commodity] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("reading prices: %w", err)
+	}
+
+	timestamps := newSampleSet()
+	for k, date := range newest {
+		timestamps.set(float64(date.Unix()), k.commodity, k.unit)
+	}
+	missing := newSampleSet()
+	for commodity := range held {
+		if currencyCode(commodity) == target {
+			continue
+		}
+		if valued[commodity] {
+			missing.set(0, commodity)
+			continue
+		}
+		log.Printf("WARNING: no %s price for held commodity %s, its valuation is frozen", target, commodity)
+		missing.set(1, commodity)
+	}
+	ledgerCommodityPriceTimestamp.publish(timestamps)
+	ledgerCommodityPriceMissing.publish(missing)
+	return nil
+}
@@ -0,0 +1,31 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import "testing"
+
+func TestParsePriceLine(t *testing.T) {
+	cases := []struct {
+		line      string
+		commodity string
+		unit      string
+		value     float64
+	}{
+		{"P 2024-01-05 AAPL 180.00 USD", "AAPL", "USD", 180},
+		{`P 2024-01-05 "VANG 500" €412,10`, "VANG 500", "€", 412.10},
+		{"P 2024-01-05 BTC €41.210,50", "BTC", "€", 41210.50},
+		{"P 2024-01-05 BTC $41,210.50", "BTC", "$", 41210.50},
+		{"P 2024-01-05 BTC $41,210", "BTC", "$", 41210},
+	}
+	for _, tc := range cases {
+		p, err := parsePriceLine(tc.line)
+		if err != nil {
+			t.Errorf("%s: %v", tc.line, err)
+			continue
+		}
+		if p.commodity != tc.commodity || p.unit != tc.unit || p.value != tc.value {
+			t.Errorf("%s: got %s in %s at %g, want %s in %s at %g",
+				tc.line, p.commodity, p.unit, p.value, tc.commodity, tc.unit, tc.value)
+		}
+	}
+}
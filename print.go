@@ -0,0 +1,111 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// posting is one row of `hledger print -O csv`, which repeats the
+// transaction fields on every posting row.
+type posting struct {
+	txn         string // txnidx, shared by all postings of a transaction
+	date        time.Time
+	description string
+	comment     string // transaction comment
+	account     string
+	amount      float64 // signed
+	commodity   string  // as written in the journal
+	currency    string  // mapped currency code, "" for unknown commodities
+	postComment string  // posting comment
+}
+
+func (p posting) month() string {
+	return p.date.Format("2006-01")
+}
+
+// print CSV columns:
+// txnidx,date,date2,status,code,description,comment,account,amount,
+// commodity,credit,debit,posting-status,posting-comment
+const printColumns = 14
+
+// runPrint runs `hledger print` for query on behalf of collector and
+// parses its CSV output. Rows that don't parse are skipped with a warning.
+func runPrint(collector string, query ...string) ([]posting, error) {
+	return runPrintOn(currentJournal(), collector, nil, query...)
+}
+
+// runValuedPrint is runPrint with the amounts valued like the balance and
+// monthly reports, see valuationArgs.
+func runValuedPrint(collector string, query ...string) ([]posting, error) {
+	return runPrintOn(currentJournal(), collector, valuationArgs(), query...)
+}
+
+// runPrintOn is runPrint for any journal and with extra options.
+func runPrintOn(file, collector string, opts []string, query ...string) ([]posting, error) {
+	// the query goes after "--" so hledger never reads it as options
+	args := slices.Concat([]string{"print", "--output-format", "csv"}, opts, []string{"--"}, query)
+	out, err := runHledgerOn(file, collector, args...)
+	if err != nil {
+		return nil, fmt.Errorf("hledger print: %w", err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading csv: %w", err)
+	}
+
+	var postings []posting
+	for i, rec := range records {
+		if i == 0 {
+			continue
+		}
+		if len(rec) < printColumns {
+			warnf("skipping print row with %d columns: %q", len(rec), rec)
+			continue
+		}
+		date, err := time.Parse("2006-01-02", strings.TrimSpace(rec[1]))
+		if err != nil {
+			warnf("could not parse date %q: %v", rec[1], err)
+			continue
+		}
+		amount, err := parseAmount(strings.TrimSpace(rec[8]))
+		if err != nil {
+			warnf("could not parse amount %q: %v", rec[8], err)
+			continue
+		}
+		commodity := strings.TrimSpace(rec[9])
+		postings = append(postings, posting{
+			txn:         strings.TrimSpace(rec[0]),
+			date:        date,
+			description: strings.TrimSpace(rec[5]),
+			comment:     rec[6],
+			account:     strings.TrimSpace(rec[7]),
+			amount:      amount,
+			commodity:   commodity,
+			currency:    map[string]string{"€": "EUR", "$": "USD"}[commodity],
+			postComment: rec[13],
+		})
+	}
+	return postings, nil
+}
+
+// byTransaction groups postings by transaction, keeping journal order.
+func byTransaction(postings []posting) [][]posting {
+	var txns [][]posting
+	index := map[string]int{}
+	for _, p := range postings {
+		i, ok := index[p.txn]
+		if !ok {
+			i = len(txns)
+			index[p.txn] = i
+			txns = append(txns, nil)
+		}
+		txns[i] = append(txns[i], p)
+	}
+	return txns
+}
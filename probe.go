@@ -0,0 +1,96 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Exit codes of -probe, so CI can tell a broken journal source apart from
+// hledger output the exporter can't make sense of.
+const (
+	probeOK             = 0
+	probeFetchFailed    = 2
+	probeCollectorsFail = 3
+	probeInvariantsFail = 4
+)
+
+// runProbe does a single full refresh, writes a summary to w and returns
+// the process exit code. The metrics gathered from reg are checked with
+// checkInvariants afterwards.
+func runProbe(w io.Writer, reg prometheus.Gatherer) int {
+	code := probeOK
+	warningsBefore := warningCount.Load()
+
+	if cfg.GiteaToken == "" || cfg.GiteaJournalURL == "" {
+		// fetchJournal does nothing then, which mustn't read as a fetch
+		fmt.Fprintln(w, "journal fetch: skipped, GITEA_TOKEN or GITEA_JOURNAL_URL unset")
+	} else {
+		start := time.Now()
+		fetchErr := fetchJournal()
+		fmt.Fprintf(w, "journal fetch: %s", time.Since(start).Round(time.Millisecond))
+		if fetchErr != nil {
+			fmt.Fprintf(w, " FAILED: %v\n", fetchErr)
+			code = probeFetchFailed
+		} else {
+			fmt.Fprintln(w, " ok")
+		}
+	}
+
+	collectorsFailed := false
+	for _, c := range collectors {
+		if !c.isEnabled() {
+			fmt.Fprintf(w, "collector %s: disabled\n", c.name)
+			continue
+		}
+		if !c.isActive() {
+			fmt.Fprintf(w, "collector %s: skipped, nothing configured\n", c.name)
+			continue
+		}
+		err := c.collect()
+		status := "ok"
+		switch {
+		case err != nil:
+			status = fmt.Sprintf("FAILED: %v", err)
+			collectorsFailed = true
+		case c.samples() == 0 && c.mayBeEmpty:
+			status = "ok, no samples"
+		case c.samples() == 0:
+			status = "FAILED: no samples"
+			collectorsFailed = true
+		}
+		fmt.Fprintf(w, "collector %s: %s %s\n", c.name, c.lastDuration.Round(time.Millisecond), status)
+
+		families := append([]*gaugeFamily(nil), c.families...)
+		sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+		for _, f := range families {
+			fmt.Fprintf(w, "  %-45s %d samples\n", f.name, f.len())
+		}
+	}
+	fmt.Fprintf(w, "warnings: %d\n", warningCount.Load()-warningsBefore)
+
+	families, err := reg.Gather()
+	violations := checkInvariants(families, clock())
+	if err != nil {
+		violations = append(violations, err)
+	}
+	if len(violations) > 0 {
+		fmt.Fprintf(w, "invariants: %d violated\n%s\n", len(violations), formatErrors(violations))
+	} else {
+		fmt.Fprintln(w, "invariants: ok")
+	}
+
+	switch {
+	case code != probeOK:
+	case collectorsFailed:
+		code = probeCollectorsFail
+	case len(violations) > 0:
+		code = probeInvariantsFail
+	}
+	return code
+}
@@ -0,0 +1,25 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestProbeSkipsUnconfiguredFetch(t *testing.T) {
+	defer func(c config, cs []*collector) { cfg, collectors = c, cs }(cfg, collectors)
+	cfg.GiteaToken, cfg.GiteaJournalURL = "", ""
+	collectors = nil
+
+	var out strings.Builder
+	if code := runProbe(&out, prometheus.NewRegistry()); code != probeOK {
+		t.Errorf("exit code %d, want %d", code, probeOK)
+	}
+	first, _, _ := strings.Cut(out.String(), "\n")
+	if !strings.Contains(first, "skipped") || strings.Contains(first, "ok") {
+		t.Errorf("without a token the probe says %q, want the fetch skipped", first)
+	}
+}
@@ -0,0 +1,115 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// heartbeatInterval is how often an idle refresh loop checks in.
+const heartbeatInterval = 10 * time.Second
+
+var (
+	refreshTriggersTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ledger_exporter_refresh_triggers_total",
+			Help: "Refresh requests by what asked for them",
+		},
+		[]string{"source"},
+	)
+
+	refreshesCoalesced = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ledger_exporter_refreshes_coalesced_total",
+			Help: "Refresh requests folded into an already scheduled refresh",
+		},
+	)
+
+	// pendingRefresh holds at most one requested refresh. Requests arriving
+	// while one is already pending are coalesced into it, so a burst during
+	// a running refresh causes exactly one follow-up.
+	pendingRefresh = make(chan string, 1)
+)
+
+// triggerRefresh asks the refresh loop for a refresh on behalf of source.
+func triggerRefresh(source string) {
+	refreshTriggersTotal.WithLabelValues(source).Inc()
+	select {
+	case pendingRefresh <- source:
+	default:
+		refreshesCoalesced.Inc()
+	}
+}
+
+// runRefresh performs one refresh and records whether it succeeded.
+func runRefresh() bool {
+	// whatever the refresh managed to publish is pushed
+	defer requestOTLPPush()
+	if err := updateMetrics(); err != nil {
+		log.Printf("refresh failed: %v", err)
+		return false
+	}
+	lastSuccess.Store(time.Now().UnixNano())
+	return true
+}
+
+// watchSignals turns SIGHUP into a refresh.
+func watchSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		triggerRefresh("sighup")
+	}
+}
+
+// refreshLoop runs every refresh, whatever triggered it, until it panics.
+// Refreshes are spaced at least cfg.MinRefreshInterval apart, and the
+// periodic timer restarts after each successful refresh, so an extra
+// refresh pushes the next periodic one out. A panic is recorded for
+// /livez rather than taking the process down, so the orchestrator gets to
+// decide about the restart.
+func refreshLoop() {
+	defer func() {
+		if r := recover(); r != nil {
+			loopFailure.Store(fmt.Sprintf("refresh loop panicked: %v", r))
+			log.Printf("refresh loop panicked: %v\n%s", r, debug.Stack())
+		}
+	}()
+	timer := time.NewTimer(cfg.RefreshInterval)
+	defer timer.Stop()
+	beat := time.NewTicker(heartbeatInterval)
+	defer beat.Stop()
+	last := time.Now()
+	for {
+		heartbeat.Store(time.Now().UnixNano())
+		var source string
+		select {
+		case <-timer.C:
+			source = "timer"
+			refreshTriggersTotal.WithLabelValues(source).Inc()
+		case source = <-pendingRefresh:
+		case <-beat.C:
+			continue
+		}
+
+		if wait := cfg.MinRefreshInterval - time.Since(last); wait > 0 {
+			log.Printf("delaying %s refresh by %s", source, wait.Round(time.Millisecond))
+			time.Sleep(wait)
+		}
+		ok := runRefresh()
+		last = time.Now()
+		// A failed refresh leaves the schedule alone, unless it was the
+		// timer's own, which has to be rearmed either way.
+		if ok || source == "timer" {
+			timer.Reset(cfg.RefreshInterval)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// parseReportEnd reads REPORT_END, a date that is excluded like hledger's
+// --end, in the exporter's time zone. Empty means the reports are live.
+func parseReportEnd(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	end, err := time.ParseInLocation("2006-01-02", v, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected a date like 2025-01-01, got %q", v)
+	}
+	return end, nil
+}
+
+// pinClock stops clock just before REPORT_END, so the last day of the
+// closed books is today: its month is current and MTD covers all of it.
+func pinClock(end time.Time) {
+	if end.IsZero() {
+		return
+	}
+	now := end.Add(-time.Nanosecond)
+	clock = func() time.Time { return now }
+}
+
+// withReportEnd makes an hledger argument list stop at REPORT_END. A
+// collector's own --end is kept when it's earlier and moved otherwise.
+func withReportEnd(args []string) []string {
+	if cfg.ReportEnd.IsZero() {
+		return args
+	}
+	end := cfg.ReportEnd.Format("2006-01-02")
+	opts := len(args)
+	if i := slices.Index(args, "--"); i >= 0 {
+		opts = i
+	}
+	for i := 0; i+1 < opts; i++ {
+		if args[i] != "--end" {
+			continue
+		}
+		if args[i+1] > end {
+			args = slices.Clone(args)
+			args[i+1] = end
+		}
+		return args
+	}
+	return slices.Insert(slices.Clone(args), opts, "--end", end)
+}
@@ -0,0 +1,74 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// sandboxDir holds the fetched journal and nothing else. hledger runs with
+// it as working directory, so relative includes can't reach anything but
+// what was fetched.
+var sandboxDir = "/tmp/ledger-exporter"
+
+// setSandboxDir moves the sandbox, and the journal with it, to dir.
+func setSandboxDir(dir string) {
+	sandboxDir = dir
+	ledgerPath = dir + "/main.journal"
+	journalFile = ledgerPath
+}
+
+// hledgerEnv is the whole environment hledger gets: no LEDGER_FILE or
+// other settings from the container leak into reports.
+func hledgerEnv() []string {
+	return []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + sandboxDir,
+		// hledger needs a UTF-8 locale for commodity symbols like €
+		"LANG=C.UTF-8",
+	}
+}
+
+// includeRe matches include directives, including the !include and
+// @include spellings hledger still accepts from older journals.
+var includeRe = regexp.MustCompile(`^[!@]?include\s+(.+?)\s*$`)
+
+// readerPrefixRe matches hledger's "csv:" style reader prefixes.
+var readerPrefixRe = regexp.MustCompile(`^[a-z]+:`)
+
+// checkIncludesIn runs checkIncludes on the journal at path.
+func checkIncludesIn(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return checkIncludes(f, dir)
+}
+
+// checkIncludes rejects include directives of journal that would resolve
+// outside dir, such as absolute paths, ~ or ../ escapes.
+func checkIncludes(journal io.Reader, dir string) error {
+	sc := bufio.NewScanner(journal)
+	for n := 1; sc.Scan(); n++ {
+		m := includeRe.FindStringSubmatch(sc.Text())
+		if m == nil {
+			continue
+		}
+		path := readerPrefixRe.ReplaceAllString(m[1], "")
+		if strings.HasPrefix(path, "~") || filepath.IsAbs(path) {
+			return fmt.Errorf("line %d: include %q points outside the sandbox", n, m[1])
+		}
+		resolved := filepath.Join(dir, path)
+		if resolved != dir && !strings.HasPrefix(resolved, dir+string(filepath.Separator)) {
+			return fmt.Errorf("line %d: include %q points outside the sandbox", n, m[1])
+		}
+	}
+	return sc.Err()
+}
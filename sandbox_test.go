@@ -0,0 +1,43 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckIncludes(t *testing.T) {
+	cases := []struct {
+		name    string
+		journal string
+		ok      bool
+	}{
+		{"relative", "include accounts.journal\n", true},
+		{"subdirectory", "include 2025/january.journal\n", true},
+		{"reader prefix", "include csv:bank/export.csv\n", true},
+		{"parent that stays inside", "include 2025/../accounts.journal\n", true},
+		{"absolute", "include /etc/passwd\n", false},
+		{"home", "include ~/.ssh/id_ed25519\n", false},
+		{"parent", "include ../secrets.journal\n", false},
+		{"nested parent", "include 2025/../../secrets.journal\n", false},
+		{"reader prefix with parent", "include csv:../x\n", false},
+		{"reader prefix with absolute path", "include csv:/etc/passwd\n", false},
+		{"bang", "!include /etc/passwd\n", false},
+		{"at", "@include ../secrets.journal\n", false},
+		{"bang relative", "!include accounts.journal\n", true},
+		{"later line", "2025-01-01 Bakery\n    expenses:food  4.20 €\n    assets:bank\n\ninclude ../x\n", false},
+		{"comment", "; include /etc/passwd\n", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := checkIncludes(strings.NewReader(c.journal), "/sandbox")
+			if c.ok && err != nil {
+				t.Errorf("rejected: %v", err)
+			}
+			if !c.ok && err == nil {
+				t.Error("accepted")
+			}
+		})
+	}
+}
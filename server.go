@@ -0,0 +1,118 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// clock is the exporter's idea of today for everything that depends on the
+// date, e.g. which month is current. It is a variable so runs against a
+// fixed journal, and REPORT_END, can pin it.
+var clock = time.Now
+
+// processStart tells this process's generations of state apart from the
+// previous one's.
+var processStart = time.Now()
+
+// Server is the HTTP side of the exporter with its own registry. The
+// collectors and their metrics are package state, so there is one Server
+// per process; main runs it on :9000, anything else can mount it on an
+// httptest server.
+type Server struct {
+	reg *prometheus.Registry
+	mux *http.ServeMux
+}
+
+// NewServer makes c the active configuration and sets up the registry and
+// routes. It doesn't refresh; call Refresh or start the refresh loop.
+func NewServer(c config) (*Server, error) {
+	cfg = c
+	setExporterInfo()
+	journalFresh.Store(time.Now().UnixNano())
+	if err := os.MkdirAll(sandboxDir, 0700); err != nil {
+		return nil, err
+	}
+	s := &Server{reg: prometheus.NewRegistry(), mux: http.NewServeMux()}
+	for _, m := range []prometheus.Collector{
+		journalCommit,
+		journalBytes,
+		journalChangedTimestamp,
+		journalChangeMagnitude,
+		seriesCount,
+		seriesDropped,
+		labelCollisions,
+		consistencyError,
+		filteredAmount,
+		otlpExports,
+		seriesGraceHeld,
+		metricLastChange,
+		parseWarnings,
+		hledgerFailures,
+		exporterInfo,
+		httpRequestsTotal,
+		httpRequestDuration,
+		httpThrottled,
+		collectorPanics,
+		refreshTriggersTotal,
+		refreshesCoalesced,
+		servingStale,
+		expositionBytes,
+	} {
+		if err := s.reg.Register(m); err != nil {
+			return nil, err
+		}
+	}
+	// Disabled collectors don't register anything, so their metrics don't
+	// even show up without samples.
+	for _, c := range collectors {
+		if !c.isEnabled() {
+			log.Printf("collector %s disabled", c.name)
+			continue
+		}
+		for _, f := range c.families {
+			if err := s.reg.Register(f); err != nil {
+				return nil, fmt.Errorf("collector %s: %w", c.name, err)
+			}
+		}
+	}
+
+	// compressMetrics does the compression to measure the payload both ways
+	metrics := promhttp.InstrumentMetricHandler(s.reg, promhttp.HandlerFor(s.reg, promhttp.HandlerOpts{
+		EnableOpenMetrics:  cfg.OpenMetricsTimestamps,
+		DisableCompression: true,
+	}))
+	s.mux.Handle("/metrics", markStale(compressMetrics(metrics)))
+	if cfg.APIToken != "" {
+		s.mux.HandleFunc("/api/v1/summary", requireAuth(summaryHandler))
+		s.mux.HandleFunc("/api/v1/history", requireAuth(historyHandler))
+		s.mux.HandleFunc("/debug/config", requireAuth(configHandler))
+	} else {
+		log.Println("API_TOKEN not set, /api/v1 and /debug endpoints are disabled")
+	}
+	if cfg.OTLPEndpoint != "" {
+		if err := startOTLP(s.reg); err != nil {
+			return nil, fmt.Errorf("OTLP_ENDPOINT: %w", err)
+		}
+	}
+	s.mux.HandleFunc("/", landingHandler)
+	s.mux.HandleFunc("/livez", livezHandler)
+	s.mux.HandleFunc("/readyz", readyzHandler)
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Refresh runs a single refresh, like the refresh loop does.
+func (s *Server) Refresh() bool {
+	return runRefresh()
+}
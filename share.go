@@ -0,0 +1,38 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var ledgerExpenseShare = newGaugeFamily(
+	prometheus.GaugeOpts{
+		Name: "ledger_expense_share",
+		Help: "Share of each category in the current month's expenses per currency; current month only, not a history",
+	},
+	[]string{"category", "currency"},
+)
+
+// publishExpenseShare divides each category's spend of the current month
+// by the month's total in the same currency, so the shares of a currency
+// add up to 1. Categories without spend and currencies whose total isn't
+// positive, e.g. a month of refunds only, are left out.
+func publishExpenseShare(parsed monthlyAmounts, now time.Time) {
+	month := now.Format("2006-01")
+	totals := map[string]float64{}
+	for k, months := range parsed {
+		totals[k.currency] += months[month]
+	}
+	shares := newSampleSet()
+	for k, months := range parsed {
+		amount := months[month]
+		if amount == 0 || totals[k.currency] <= 0 {
+			continue
+		}
+		shares.set(amount/totals[k.currency], k.category, k.currency)
+	}
+	ledgerExpenseShare.publish(shares)
+}
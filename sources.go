@@ -0,0 +1,69 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var ledgerSourceLastPosting = newGaugeFamily(
+	prometheus.GaugeOpts{
+		Name: "ledger_source_last_posting_timestamp_seconds",
+		Help: "Date of the newest posting tagged source:<source>, 0 if there is none",
+	},
+	[]string{"source"},
+)
+
+// sourceTagRe finds a source tag in a transaction or posting comment.
+// Tag values run until the next comma or the end of the line.
+var sourceTagRe = regexp.MustCompile(`(?:^|[\s,])source:([^,\n]*)`)
+
+func sourceTag(comment string) (string, bool) {
+	m := sourceTagRe.FindStringSubmatch(comment)
+	if m == nil {
+		return "", false
+	}
+	return strings.TrimSpace(m[1]), true
+}
+
+func collectSourceLastPosting() error {
+	if len(cfg.SourceTags) == 0 {
+		return nil
+	}
+	log.Println("collectSourceLastPosting called")
+	postings, err := runPrint("sources", "tag:source")
+	if err != nil {
+		return err
+	}
+
+	newest := map[string]time.Time{}
+	for _, p := range postings {
+		// A posting's own tag wins over the one inherited from its transaction.
+		source, ok := sourceTag(p.postComment)
+		if !ok {
+			source, ok = sourceTag(p.comment)
+		}
+		if !ok {
+			continue
+		}
+		if p.date.After(newest[source]) {
+			newest[source] = p.date
+		}
+	}
+
+	set := newSampleSet()
+	for _, source := range cfg.SourceTags {
+		ts := 0.0
+		if t, ok := newest[source]; ok {
+			ts = float64(t.Unix())
+		}
+		set.set(ts, source)
+	}
+	ledgerSourceLastPosting.publish(set)
+	return nil
+}
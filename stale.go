@@ -0,0 +1,49 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// staleHeader is set on /metrics responses while the financial gauges are
+// withheld.
+const staleHeader = "X-Ledger-Exporter-Stale"
+
+// journalFresh is when the last refresh with a successfully fetched journal
+// finished, or when the server was set up before that.
+var journalFresh atomic.Int64
+
+var servingStale = prometheus.NewGaugeFunc(
+	prometheus.GaugeOpts{
+		Name: "ledger_exporter_serving_stale",
+		Help: "1 while the journal couldn't be fetched for longer than STALE_AFTER and the ledger metrics are withheld",
+	},
+	func() float64 {
+		if isStale() {
+			return 1
+		}
+		return 0
+	},
+)
+
+// isStale reports whether the journal source has been failing for longer
+// than cfg.StaleAfter. Exported gauges are withheld meanwhile, so
+// Prometheus marks them stale instead of showing old numbers as current.
+func isStale() bool {
+	return cfg.StaleAfter > 0 && time.Since(time.Unix(0, journalFresh.Load())) > cfg.StaleAfter
+}
+
+// markStale flags /metrics responses served without the ledger metrics.
+func markStale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isStale() {
+			w.Header().Set(staleHeader, "true")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,207 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recentWindow is how far back the biggest recent transactions are taken from.
+const recentWindow = 30 * 24 * time.Hour
+
+// summary is the document served at /api/v1/summary. Field names are part
+// of the API, don't rename them.
+type summary struct {
+	Generation          uint64               `json:"generation"`
+	GeneratedAt         time.Time            `json:"generated_at"`
+	Month               string               `json:"month"`
+	Spend               []categorySpend      `json:"current_month_spend"`
+	TotalAssets         map[string]float64   `json:"total_assets"`
+	TotalLiabilities    map[string]float64   `json:"total_liabilities"`
+	NetWorth            map[string]float64   `json:"net_worth"`
+	BiggestTransactions []summaryTransaction `json:"biggest_recent_transactions"`
+}
+
+type categorySpend struct {
+	Category      string  `json:"category"`
+	Currency      string  `json:"currency"`
+	Amount        float64 `json:"amount"`
+	PreviousMonth float64 `json:"previous_month"`
+	Change        float64 `json:"change"`
+}
+
+type summaryTransaction struct {
+	Date        string  `json:"date"`
+	Description string  `json:"description"`
+	Currency    string  `json:"currency"`
+	Amount      float64 `json:"amount"`
+}
+
+var (
+	snapshotMu sync.RWMutex
+	snapshot   summary
+	// snapshotJSON is snapshot pre-encoded, since it only changes once per refresh.
+	snapshotJSON []byte
+
+	// biggestRecent is left behind by the payee collector for the next
+	// snapshot.
+	biggestRecent []summaryTransaction
+)
+
+// biggestTransactions returns the n largest expense transactions of the
+// last recentWindow, summing the expense postings of each.
+func biggestTransactions(postings []posting, now time.Time, n int) []summaryTransaction {
+	var txns []summaryTransaction
+	for _, txn := range byTransaction(postings) {
+		if now.Sub(txn[0].date) > recentWindow {
+			continue
+		}
+		t := summaryTransaction{
+			Date:        txn[0].date.Format("2006-01-02"),
+			Description: txn[0].description,
+		}
+		for _, p := range txn {
+			if _, ok := familyCategory("expenses", p.account); ok && p.amount > 0 {
+				t.Amount += p.amount
+				t.Currency = p.currency
+			}
+		}
+		if t.Amount > 0 {
+			txns = append(txns, t)
+		}
+	}
+	sort.SliceStable(txns, func(i, j int) bool { return txns[i].Amount > txns[j].Amount })
+	if len(txns) > n {
+		txns = txns[:n]
+	}
+	return txns
+}
+
+// rebuildSnapshot assembles the summary from what the collectors last
+// published and bumps the generation. now picks the report month, which
+// REPORT_END pins; generated_at is always the wall clock.
+func rebuildSnapshot(now time.Time) {
+	month := now.Format("2006-01")
+	firstOfThisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	previousMonth := firstOfThisMonth.AddDate(0, 0, -1).Format("2006-01")
+
+	type key struct{ category, currency string }
+	current := map[key]float64{}
+	previous := map[key]float64{}
+	for _, s := range ledgerExpensesMonthly.snapshot() {
+		category, _, _ := strings.Cut(s.labels[0], ":")
+		k := key{category, s.labels[1]}
+		switch s.labels[2] {
+		case month:
+			current[k] += s.value
+		case previousMonth:
+			previous[k] += s.value
+		}
+	}
+	spend := []categorySpend{}
+	for k, amount := range current {
+		spend = append(spend, categorySpend{
+			Category:      k.category,
+			Currency:      k.currency,
+			Amount:        amount,
+			PreviousMonth: previous[k],
+			Change:        amount - previous[k],
+		})
+	}
+	sort.Slice(spend, func(i, j int) bool {
+		if spend[i].Currency != spend[j].Currency {
+			return spend[i].Currency < spend[j].Currency
+		}
+		return spend[i].Amount > spend[j].Amount
+	})
+
+	byCurrency := func(f *gaugeFamily) map[string]float64 {
+		m := map[string]float64{}
+		for _, s := range f.snapshot() {
+			m[s.labels[0]] += s.value
+		}
+		return m
+	}
+	assets := byCurrency(ledgerTotalAssets)
+	liabilities := byCurrency(ledgerTotalLiabilities)
+	netWorth := map[string]float64{}
+	for c, v := range assets {
+		netWorth[c] += v
+	}
+	// hledger keeps liabilities negative, so they're simply added.
+	for c, v := range liabilities {
+		netWorth[c] += v
+	}
+
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+	biggest := biggestRecent
+	if biggest == nil {
+		biggest = []summaryTransaction{}
+	}
+	next := summary{
+		Generation:          snapshot.Generation + 1,
+		GeneratedAt:         time.Now().UTC(),
+		Month:               month,
+		Spend:               spend,
+		TotalAssets:         assets,
+		TotalLiabilities:    liabilities,
+		NetWorth:            netWorth,
+		BiggestTransactions: biggest,
+	}
+	data, err := json.Marshal(next)
+	if err != nil {
+		log.Printf("encoding summary: %v", err)
+		return
+	}
+	snapshot, snapshotJSON = next, data
+}
+
+func summaryHandler(w http.ResponseWriter, r *http.Request) {
+	snapshotMu.RLock()
+	gen, data := snapshot.Generation, snapshotJSON
+	snapshotMu.RUnlock()
+	if data == nil {
+		http.Error(w, "no snapshot yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	// generations start over with the process, the start time keeps an
+	// ETag from before a restart from matching
+	etag := fmt.Sprintf(`"%x-%d"`, processStart.UnixNano(), gen)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// requireAuth only lets requests carrying cfg.APIToken as bearer token through.
+func requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return bearerAuth(cfg.APIToken, next)
+}
+
+// bearerAuth only lets requests carrying token through.
+func bearerAuth(token string, next http.HandlerFunc) http.HandlerFunc {
+	want := []byte("Bearer " + token)
+	return func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ledger_exporter"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,126 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSummarySchema(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	monthly := newSampleSet()
+	monthly.set(120, "food:groceries", "EUR", "2024-03", "current")
+	monthly.set(100, "food:groceries", "EUR", "2024-02", "previous")
+	ledgerExpensesMonthly.publish(monthly)
+	assets := newSampleSet()
+	assets.set(5000, "EUR")
+	ledgerTotalAssets.publish(assets)
+	liabilities := newSampleSet()
+	liabilities.set(-800, "EUR")
+	ledgerTotalLiabilities.publish(liabilities)
+	rebuildSnapshot(now)
+
+	rec := httptest.NewRecorder()
+	summaryHandler(rec, httptest.NewRequest("GET", "/api/v1/summary", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	// the field names and types are the API
+	want := map[string]string{
+		"generation":                  "number",
+		"generated_at":                "string",
+		"month":                       "string",
+		"current_month_spend":         "array",
+		"total_assets":                "object",
+		"total_liabilities":           "object",
+		"net_worth":                   "object",
+		"biggest_recent_transactions": "array",
+	}
+	for field, typ := range want {
+		if got := jsonType(doc[field]); got != typ {
+			t.Errorf("%s is %s, want %s", field, got, typ)
+		}
+	}
+	for field := range doc {
+		if _, ok := want[field]; !ok {
+			t.Errorf("unexpected field %s", field)
+		}
+	}
+	spend := doc["current_month_spend"].([]any)
+	if len(spend) != 1 {
+		t.Fatalf("current_month_spend = %v", spend)
+	}
+	for field, typ := range map[string]string{
+		"category": "string", "currency": "string", "amount": "number", "previous_month": "number", "change": "number",
+	} {
+		if got := jsonType(spend[0].(map[string]any)[field]); got != typ {
+			t.Errorf("current_month_spend.%s is %s, want %s", field, got, typ)
+		}
+	}
+	if doc["month"] != "2024-03" || doc["net_worth"].(map[string]any)["EUR"] != 4200.0 {
+		t.Errorf("month %v, net worth %v", doc["month"], doc["net_worth"])
+	}
+}
+
+func jsonType(v any) string {
+	switch v.(type) {
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	case nil:
+		return "missing"
+	}
+	return "other"
+}
+
+func TestSummaryETag(t *testing.T) {
+	rebuildSnapshot(time.Now())
+	rec := httptest.NewRecorder()
+	summaryHandler(rec, httptest.NewRequest("GET", "/api/v1/summary", nil))
+	etag := rec.Header().Get("ETag")
+
+	req := httptest.NewRequest("GET", "/api/v1/summary", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	summaryHandler(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("same generation: status %d, want 304", rec.Code)
+	}
+
+	// the same generation of an earlier process
+	defer func(start time.Time) { processStart = start }(processStart)
+	processStart = processStart.Add(-time.Hour)
+	rec = httptest.NewRecorder()
+	summaryHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("after a restart: status %d, want 200", rec.Code)
+	}
+}
+
+func TestSummaryGeneratedAtUnderReportEnd(t *testing.T) {
+	end := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	before := time.Now()
+	rebuildSnapshot(end.Add(-time.Nanosecond))
+	snapshotMu.RLock()
+	got := snapshot
+	snapshotMu.RUnlock()
+	if got.Month != "2023-12" {
+		t.Errorf("month = %s, want the pinned 2023-12", got.Month)
+	}
+	if got.GeneratedAt.Before(before.Truncate(time.Second)) {
+		t.Errorf("generated_at = %s, want the wall clock", got.GeneratedAt)
+	}
+}
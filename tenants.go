@@ -0,0 +1,304 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// tenant is one person's exporter in TENANTS_FILE.
+type tenant struct {
+	// Env is the tenant's configuration: the same variables a single
+	// exporter reads, e.g. GITEA_TOKEN and GITEA_JOURNAL_URL. Of the
+	// parent's environment only PATH and TZ are passed on.
+	Env map[string]string `json:"env"`
+	// ScrapeToken guards /metrics/<tenant>.
+	ScrapeToken string `json:"scrape_token"`
+
+	name string
+	addr string
+	// listener is bound by the parent for as long as it runs and handed
+	// to every child it starts, so no other process can take the port
+	// between a child's restarts.
+	listener *net.TCPListener
+}
+
+// tenantsFile is the TENANTS_FILE format.
+type tenantsFile struct {
+	Tenants map[string]*tenant `json:"tenants"`
+	// CombinedToken guards the combined /metrics, which isn't served
+	// without one.
+	CombinedToken string `json:"combined_token"`
+}
+
+var tenantNameRe = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+func loadTenants(path string) (*tenantsFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f tenantsFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if len(f.Tenants) == 0 {
+		return nil, fmt.Errorf("%s has no tenants", path)
+	}
+	for name, t := range f.Tenants {
+		if !tenantNameRe.MatchString(name) {
+			return nil, fmt.Errorf("tenant name %q may only contain a-z, 0-9, _ and -", name)
+		}
+		if t.ScrapeToken == "" {
+			return nil, fmt.Errorf("tenant %s has no scrape_token", name)
+		}
+		t.name = name
+	}
+	return &f, nil
+}
+
+// runTenants serves every tenant of TENANTS_FILE from a child exporter of
+// its own. The exporter keeps its state in globals, so a process per
+// tenant is what keeps their registries, settings, refresh schedules and
+// failures apart. Each child gets its own sandbox directory with
+// STRICT_INCLUDES, so no journal can include another tenant's, and
+// serves a loopback listener this process binds for it.
+func runTenants(path, addr string) error {
+	tf, err := loadTenants(path)
+	if err != nil {
+		return err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(tf.Tenants))
+	for name := range tf.Tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var wg sync.WaitGroup
+	mux := http.NewServeMux()
+	var gatherers prometheus.Gatherers
+	for _, name := range names {
+		t := tf.Tenants[name]
+		if t.listener, err = loopbackListener(); err != nil {
+			return err
+		}
+		defer t.listener.Close()
+		t.addr = t.listener.Addr().String()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			superviseTenant(ctx, self, t)
+		}()
+		target := &url.URL{Scheme: "http", Host: t.addr}
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		mux.HandleFunc("/metrics/"+name, bearerAuth(t.ScrapeToken, func(w http.ResponseWriter, r *http.Request) {
+			r.URL.Path = "/metrics"
+			proxy.ServeHTTP(w, r)
+		}))
+		gatherers = append(gatherers, tenantGatherer{t})
+	}
+	if tf.CombinedToken != "" {
+		// a tenant that can't be reached is logged and left out
+		combined := promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError, ErrorLog: log.Default()})
+		mux.HandleFunc("/metrics", bearerAuth(tf.CombinedToken, combined.ServeHTTP))
+	} else {
+		log.Println("combined_token not set, the combined /metrics is disabled")
+	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		for _, name := range names {
+			fmt.Fprintf(w, "/metrics/%s\n", name)
+		}
+	})
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	log.Printf("Serving %d tenants on %s", len(names), addr)
+	err = srv.ListenAndServe()
+	stop()
+	wg.Wait()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// loopbackListener binds a free loopback port for a child to serve on.
+func loopbackListener() (*net.TCPListener, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	return l.(*net.TCPListener), nil
+}
+
+// listenFDEnv tells a child which of its file descriptors is the listener
+// the parent bound for it.
+const listenFDEnv = "LEDGER_EXPORTER_LISTEN_FD"
+
+// listen binds addr, or in a tenant's child takes over the listener
+// passed down by runTenantChild.
+func listen(addr string) (net.Listener, error) {
+	v := os.Getenv(listenFDEnv)
+	if v == "" {
+		return net.Listen("tcp", addr)
+	}
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", listenFDEnv, err)
+	}
+	f := os.NewFile(uintptr(fd), "listener")
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// superviseTenant runs the tenant's child exporter until ctx is done,
+// restarting it with a growing delay whenever it exits.
+func superviseTenant(ctx context.Context, self string, t *tenant) {
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := runTenantChild(ctx, self, t)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > time.Minute {
+			backoff = time.Second
+		}
+		log.Printf("tenant %s exited (%v), restarting in %s", t.name, err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(2*backoff, time.Minute)
+	}
+}
+
+func runTenantChild(ctx context.Context, self string, t *tenant) error {
+	cmd := exec.CommandContext(ctx, self)
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = 10 * time.Second
+	cmd.Env = tenantEnv(t)
+	// the child's copy of the listener is ExtraFiles[0], i.e. fd 3
+	listener, err := t.listener.File()
+	if err != nil {
+		return err
+	}
+	cmd.ExtraFiles = []*os.File{listener}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	// the exporter logs to stderr, send the odd stdout line the same way
+	cmd.Stdout = cmd.Stderr
+	err = cmd.Start()
+	listener.Close()
+	if err != nil {
+		return err
+	}
+	sc := bufio.NewScanner(stderr)
+	for sc.Scan() {
+		log.Printf("[%s] %s", t.name, sc.Text())
+	}
+	return cmd.Wait()
+}
+
+// tenantEnv is the whole environment of t's child: PATH, TZ unless the
+// tenant sets its own, and the tenant's settings.
+func tenantEnv(t *tenant) []string {
+	env := []string{"PATH=" + os.Getenv("PATH")}
+	if tz, ok := os.LookupEnv("TZ"); ok {
+		env = append(env, "TZ="+tz)
+	}
+	for k, v := range t.Env {
+		env = append(env, k+"="+v)
+	}
+	// set last, so the tenant's settings can't override them; a child
+	// with a TENANTS_FILE would start tenants of its own
+	return append(env,
+		"TENANTS_FILE=",
+		"LISTEN_ADDR="+t.addr,
+		listenFDEnv+"=3",
+		"SANDBOX_DIR="+sandboxDir+"-"+t.name,
+		"STRICT_INCLUDES=true",
+	)
+}
+
+// tenantGatherer reads a child's /metrics for the combined endpoint and
+// adds the tenant label to every series.
+type tenantGatherer struct {
+	t *tenant
+}
+
+var tenantLabel = "tenant"
+
+// tenantClient talks to the children; their /metrics doesn't involve any
+// outbound request, so it answers quickly or not at all.
+var tenantClient = &http.Client{Timeout: 10 * time.Second}
+
+func (g tenantGatherer) Gather() ([]*dto.MetricFamily, error) {
+	req, _ := http.NewRequest("GET", "http://"+g.t.addr+"/metrics", nil)
+	req.Header.Set("Accept", string(expfmt.NewFormat(expfmt.TypeTextPlain)))
+	resp, err := tenantClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("tenant %s: %w", g.t.name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tenant %s: /metrics returned %s", g.t.name, resp.Status)
+	}
+	var parser expfmt.TextParser
+	byName, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("tenant %s: %w", g.t.name, err)
+	}
+	families := make([]*dto.MetricFamily, 0, len(byName))
+	for _, mf := range byName {
+		for _, m := range mf.Metric {
+			if slices.ContainsFunc(m.Label, func(l *dto.LabelPair) bool { return l.GetName() == tenantLabel }) {
+				continue
+			}
+			m.Label = append(m.Label, &dto.LabelPair{Name: &tenantLabel, Value: &g.t.name})
+			sort.Slice(m.Label, func(i, j int) bool { return m.Label[i].GetName() < m.Label[j].GetName() })
+		}
+		families = append(families, mf)
+	}
+	return families, nil
+}
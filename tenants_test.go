@@ -0,0 +1,84 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// lastValue looks up key in env the way exec.Cmd does: the last entry wins.
+func lastValue(env []string, key string) (string, bool) {
+	value, found := "", false
+	for _, kv := range env {
+		if k, v, _ := strings.Cut(kv, "="); k == key {
+			value, found = v, true
+		}
+	}
+	return value, found
+}
+
+func TestTenantEnv(t *testing.T) {
+	t.Setenv("TZ", "Europe/Berlin")
+	t.Setenv("GITEA_TOKEN", "parent")
+	tn := &tenant{name: "alice", addr: "127.0.0.1:4711", Env: map[string]string{
+		"GITEA_TOKEN":     "alice",
+		"TENANTS_FILE":    "/etc/tenants.json",
+		"LISTEN_ADDR":     ":9000",
+		"STRICT_INCLUDES": "false",
+		listenFDEnv:       "0",
+	}}
+	env := tenantEnv(tn)
+	for key, want := range map[string]string{
+		"TZ":              "Europe/Berlin",
+		"GITEA_TOKEN":     "alice",
+		"TENANTS_FILE":    "",
+		"LISTEN_ADDR":     "127.0.0.1:4711",
+		"STRICT_INCLUDES": "true",
+		listenFDEnv:       "3",
+		"SANDBOX_DIR":     sandboxDir + "-alice",
+	} {
+		if got, ok := lastValue(env, key); !ok || got != want {
+			t.Errorf("%s = %q (%v), want %q", key, got, ok, want)
+		}
+	}
+
+	tn.Env["TZ"] = "Pacific/Auckland"
+	if got, _ := lastValue(tenantEnv(tn), "TZ"); got != "Pacific/Auckland" {
+		t.Errorf("tenant TZ = %q, want its own Pacific/Auckland", got)
+	}
+}
+
+func TestListenInherited(t *testing.T) {
+	parent, err := loopbackListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parent.Close()
+	f, err := parent.File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(listenFDEnv, strconv.Itoa(int(f.Fd())))
+	l, err := listen(":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if l.Addr().String() != parent.Addr().String() {
+		t.Fatalf("listening on %s, want the inherited %s", l.Addr(), parent.Addr())
+	}
+
+	conn, err := net.Dial("tcp", parent.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	accepted, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted.Close()
+}
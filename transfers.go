@@ -0,0 +1,104 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"log"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// transferDepth limits from_account and to_account to e.g. "assets:bank".
+const transferDepth = 2
+
+var ledgerTransfersMonthly = newGaugeFamily(
+	prometheus.GaugeOpts{
+		Name: "ledger_transfers_monthly",
+		Help: "Monthly money moved between own asset and liability accounts, by source, destination and currency",
+	},
+	[]string{"from_account", "to_account", "currency", "month"},
+)
+
+func truncateAccount(account string, depth int) string {
+	parts := strings.SplitN(account, ":", depth+1)
+	if len(parts) > depth {
+		parts = parts[:depth]
+	}
+	return strings.Join(parts, ":")
+}
+
+type transferLeg struct {
+	account string
+	amount  float64 // always positive
+}
+
+// matchTransfers pairs the legs money leaves with the legs it arrives at,
+// biggest first, and calls fn for every pair.
+func matchTransfers(from, to []transferLeg, fn func(from, to string, amount float64)) {
+	byAmount := func(legs []transferLeg) {
+		sort.SliceStable(legs, func(i, j int) bool { return legs[i].amount > legs[j].amount })
+	}
+	byAmount(from)
+	byAmount(to)
+	for i, j := 0, 0; i < len(from) && j < len(to); {
+		amount := math.Min(from[i].amount, to[j].amount)
+		fn(from[i].account, to[j].account, amount)
+		from[i].amount -= amount
+		to[j].amount -= amount
+		if from[i].amount <= 1e-9 {
+			i++
+		}
+		if to[j].amount <= 1e-9 {
+			j++
+		}
+	}
+}
+
+// collectTransfers reports transactions that only move money between
+// asset and liability accounts. Anything with another leg, e.g. a fee
+// booked as an expense, is not a plain transfer and is left out.
+// Transactions with more than two legs are decomposed by matchTransfers.
+func collectTransfers() error {
+	log.Println("collectTransfers called")
+	postings, err := runPrint("transfers", append(familyQuery("assets"), familyQuery("liabilities")...)...)
+	if err != nil {
+		return err
+	}
+
+	transfers := newSampleSet()
+	for _, txn := range byTransaction(postings) {
+		own := true
+		for _, p := range txn {
+			own = own && isFundingAccount(p.account)
+		}
+		if !own || len(txn) < 2 {
+			continue
+		}
+		if len(txn) > 2 {
+			log.Printf("decomposing transfer on %s (%s) with %d postings", txn[0].date.Format("2006-01-02"), txn[0].description, len(txn))
+		}
+		from := map[string][]transferLeg{}
+		to := map[string][]transferLeg{}
+		for _, p := range txn {
+			currency := conversionCurrency(p)
+			leg := transferLeg{truncateAccount(p.account, transferDepth), math.Abs(p.amount)}
+			if p.amount < 0 {
+				from[currency] = append(from[currency], leg)
+			} else if p.amount > 0 {
+				to[currency] = append(to[currency], leg)
+			}
+		}
+		for currency := range from {
+			matchTransfers(from[currency], to[currency], func(f, t string, amount float64) {
+				if f != t {
+					transfers.add(amount, f, t, currency, txn[0].month())
+				}
+			})
+		}
+	}
+	ledgerTransfersMonthly.publish(transfers)
+	return nil
+}
@@ -0,0 +1,100 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// trendWindows are the trailing windows, in complete months, the expense
+// trend is fitted over.
+var trendWindows = []int{6, 12}
+
+// minTrendPoints is the least number of months a fit is attempted with.
+const minTrendPoints = 3
+
+var (
+	ledgerExpensesTrendSlope = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_expenses_trend_slope",
+			Help: "Linear trend of monthly expenses over the last complete months, in currency units per month",
+		},
+		[]string{"category", "currency", "window"},
+	)
+
+	ledgerExpensesTrendR2 = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_expenses_trend_r2",
+			Help: "Coefficient of determination of ledger_expenses_trend_slope",
+		},
+		[]string{"category", "currency", "window"},
+	)
+)
+
+// collectExpenseTrends fits a least-squares line through each category's
+// monthly spend. A category's window never reaches back past the first
+// month it appears in, and months without postings after that count as
+// zero spend rather than missing data.
+func collectExpenseTrends(parsed monthlyAmounts, now time.Time) {
+	slopes := newSampleSet()
+	r2s := newSampleSet()
+	firstOfThisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	for k, months := range parsed {
+		firstMonth := ""
+		for m := range months {
+			if firstMonth == "" || m < firstMonth {
+				firstMonth = m
+			}
+		}
+		for _, size := range trendWindows {
+			var ys []float64
+			for i := size; i >= 1; i-- {
+				m := firstOfThisMonth.AddDate(0, -i, 0).Format("2006-01")
+				if m >= firstMonth {
+					ys = append(ys, months[m])
+				}
+			}
+			if len(ys) < minTrendPoints {
+				continue
+			}
+			window := fmt.Sprintf("%dm", size)
+			slope, r2 := linearFit(ys)
+			slopes.set(slope, k.category, k.currency, window)
+			r2s.set(r2, k.category, k.currency, window)
+		}
+	}
+	ledgerExpensesTrendSlope.publish(slopes)
+	ledgerExpensesTrendR2.publish(r2s)
+}
+
+// linearFit regresses ys against their index 0..n-1. A series without any
+// variance is fitted exactly by a flat line and reports r2 = 1.
+func linearFit(ys []float64) (slope, r2 float64) {
+	n := float64(len(ys))
+	var meanX, meanY float64
+	for i, y := range ys {
+		meanX += float64(i)
+		meanY += y
+	}
+	meanX /= n
+	meanY /= n
+
+	var sxx, sxy, syy float64
+	for i, y := range ys {
+		dx, dy := float64(i)-meanX, y-meanY
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if sxx == 0 {
+		return 0, 0
+	}
+	slope = sxy / sxx
+	if syy == 0 {
+		return slope, 1
+	}
+	return slope, sxy * sxy / (sxx * syy)
+}
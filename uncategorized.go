@@ -0,0 +1,75 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ledgerUncategorizedExpenses = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_uncategorized_expenses",
+			Help: "Monthly expenses booked to bare expenses or a JUNK_DRAWER_ACCOUNTS account",
+		},
+		[]string{"currency", "month"},
+	)
+
+	ledgerUncategorizedPostings = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_uncategorized_postings",
+			Help: "Monthly number of postings to bare expenses or a JUNK_DRAWER_ACCOUNTS account",
+		},
+		[]string{"currency", "month"},
+	)
+)
+
+// defaultJunkDrawers are misc and unknown under every expense account type.
+func defaultJunkDrawers(types []accountType) []string {
+	var junk []string
+	for _, t := range types {
+		if t.Family == "expenses" {
+			junk = append(junk, t.under()+"misc", t.under()+"unknown")
+		}
+	}
+	return junk
+}
+
+// isUncategorized reports whether an expense posting never got a real
+// category: it is booked to the top level account itself, or to one of
+// the junk drawers or their subaccounts.
+func isUncategorized(account string) bool {
+	if !strings.Contains(account, ":") {
+		return true
+	}
+	for _, junk := range cfg.JunkDrawers {
+		if account == junk || strings.HasPrefix(account, junk+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// collectUncategorized sums and counts the uncategorized expense postings
+// per month, valued like ledger_expenses_monthly.
+func collectUncategorized() error {
+	log.Println("collectUncategorized called")
+	postings, err := runValuedPrint("uncategorized", familyQuery("expenses")...)
+	if err != nil {
+		return err
+	}
+	amounts := newSampleSet()
+	counts := newSampleSet()
+	for _, p := range postings {
+		if inFamily("expenses", p.account) && isUncategorized(p.account) {
+			amounts.add(p.amount, p.currency, p.month())
+			counts.add(1, p.currency, p.month())
+		}
+	}
+	ledgerUncategorizedExpenses.publish(amounts)
+	ledgerUncategorizedPostings.publish(counts)
+	return nil
+}
@@ -0,0 +1,42 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import "testing"
+
+func TestUncategorizedWithoutPayee(t *testing.T) {
+	old := cfg
+	defer func() { cfg = old }()
+	cfg.AccountTypes = defaultAccountTypes()
+	cfg.JunkDrawers = defaultJunkDrawers(cfg.AccountTypes)
+	enabled, err := parseCollectors("all,-payee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Collectors = enabled
+	c := collectorByName(t, "uncategorized")
+	if !c.isActive() {
+		t.Fatal("uncategorized doesn't run with payee disabled")
+	}
+
+	defer func(exec func(...string) ([]byte, []byte, error)) { hledgerExec = exec }(hledgerExec)
+	hledgerExec = func(args ...string) ([]byte, []byte, error) {
+		return []byte(`"txnidx","date","date2","status","code","description","comment","account","amount","commodity","credit","debit","posting-status","posting-comment"
+"1","2024-03-02","","","","Kiosk","","expenses:misc","4.00","$","","4.00","",""
+"1","2024-03-02","","","","Kiosk","","assets:cash","-4.00","$","4.00","","",""
+"2","2024-03-09","","","","Bookshop","","expenses:books","12.35","$","","12.35","",""
+"2","2024-03-09","","","","Bookshop","","assets:bank","-12.35","$","12.35","","",""
+"3","2024-03-20","","","","Something","","expenses:unknown:cash","3.00","$","","3.00","",""
+"3","2024-03-20","","","","Something","","assets:cash","-3.00","$","3.00","","",""
+`), nil, nil
+	}
+	if err := c.collect(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := published(ledgerUncategorizedExpenses, "USD", "2024-03"); got != 7 {
+		t.Errorf("uncategorized expenses = %v, want 7", got)
+	}
+	if got, _ := published(ledgerUncategorizedPostings, "USD", "2024-03"); got != 2 {
+		t.Errorf("uncategorized postings = %v, want 2", got)
+	}
+}
@@ -0,0 +1,57 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// exporterInfo describes what the exported numbers mean, so dashboards can
+// say whether they show cost or market value.
+var exporterInfo = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "ledger_exporter_info",
+		Help: "Always 1, labelled with the valuation settings in effect",
+	},
+	[]string{"valuation", "valuation_currency", "infer_market_prices"},
+)
+
+func setExporterInfo() {
+	valuation := cfg.Valuation
+	if valuation == "" {
+		valuation = "cost"
+	}
+	exporterInfo.Reset()
+	exporterInfo.WithLabelValues(valuation, cfg.ValuationCurrency, strconv.FormatBool(cfg.InferMarketPrices)).Set(1)
+}
+
+func parseValuation(v string) (string, error) {
+	switch v {
+	case "", "cost":
+		return "", nil
+	case "end", "then":
+		return v, nil
+	}
+	return "", fmt.Errorf("expected cost, end or then, got %q", v)
+}
+
+// valuationArgs are the hledger flags for the balance and monthly reports.
+// VALUATION=end values everything at today's market prices, then at the
+// prices of each posting's date, which keeps past months as they were.
+func valuationArgs() []string {
+	var args []string
+	if cfg.InferMarketPrices {
+		args = append(args, "--infer-market-prices")
+	}
+	if cfg.Valuation != "" {
+		value := cfg.Valuation
+		if cfg.ValuationCurrency != "" {
+			value += "," + cfg.ValuationCurrency
+		}
+		args = append(args, "--value", value)
+	}
+	return args
+}
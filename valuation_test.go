@@ -0,0 +1,153 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// valuationCases are the valuation modes run on testdata/valuation, and
+// what they make of the shares in assets:broker: nothing in dollars without
+// market prices, today's inferred price ($200) with end and each
+// purchase's price with then.
+var valuationCases = []struct {
+	valuation string
+	infer     bool
+	broker    float64 // 0 for no dollar value
+}{
+	{"", false, 0},
+	{"end", false, 0},
+	{"end", true, 3000},
+	{"then", true, 2700},
+}
+
+func setValuation(t *testing.T, valuation string, infer bool) {
+	t.Helper()
+	old := cfg
+	t.Cleanup(func() { cfg = old })
+	cfg.AccountTypes = defaultAccountTypes()
+	cfg.Valuation, cfg.InferMarketPrices, cfg.ValuationCurrency = valuation, infer, "$"
+}
+
+func checkBroker(t *testing.T, name string, want float64) {
+	t.Helper()
+	if err := collectBalances("assets", assetGauge, ledgerTotalAssets); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	got, ok := published(assetGauge, "broker", "USD")
+	switch {
+	case want == 0 && ok:
+		t.Errorf("%s: broker valued at $%g without market prices", name, got)
+	case want != 0 && got != want:
+		t.Errorf("%s: broker = $%g (%v), want $%g", name, got, ok, want)
+	}
+	if bank, _ := published(assetGauge, "bank", "USD"); bank != -2700 {
+		t.Errorf("%s: bank = $%g, want $-2700 in every mode", name, bank)
+	}
+}
+
+// TestValuationFixtures replays hledger's output for each mode, picked by
+// the flags the exporter passes.
+func TestValuationFixtures(t *testing.T) {
+	defer func(exec func(...string) ([]byte, []byte, error)) { hledgerExec = exec }(hledgerExec)
+	hledgerExec = func(args ...string) ([]byte, []byte, error) {
+		fixture := "cost"
+		if i := slices.Index(args, "--value"); i >= 0 {
+			mode, currency, _ := strings.Cut(args[i+1], ",")
+			if currency != "$" {
+				t.Errorf("valued in %q, want $", currency)
+			}
+			fixture = mode
+			if slices.Contains(args, "--infer-market-prices") {
+				fixture += "-infer"
+			}
+		}
+		out, err := os.ReadFile(filepath.Join("testdata", "valuation", fixture+".txt"))
+		return out, nil, err
+	}
+	for _, tc := range valuationCases {
+		name := tc.valuation
+		if tc.infer {
+			name += "+infer"
+		}
+		setValuation(t, tc.valuation, tc.infer)
+		checkBroker(t, name, tc.broker)
+	}
+}
+
+// TestValuationHledger runs the same cases against the real hledger, which
+// keeps the fixtures honest.
+func TestValuationHledger(t *testing.T) {
+	if _, err := exec.LookPath("hledger"); err != nil {
+		t.Skip("hledger not installed")
+	}
+	journal, err := os.ReadFile(filepath.Join("testdata", "valuation", "valuation.journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer setSandboxDir(sandboxDir)
+	setSandboxDir(t.TempDir())
+	if err := os.WriteFile(ledgerPath, journal, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range valuationCases {
+		setValuation(t, tc.valuation, tc.infer)
+		checkBroker(t, tc.valuation+" real", tc.broker)
+	}
+}
+
+// TestOtherCommodityPassesInvariants keeps -probe from flagging the empty
+// currency label of commodities other than € and $.
+func TestOtherCommodityPassesInvariants(t *testing.T) {
+	defer func(exec func(...string) ([]byte, []byte, error)) { hledgerExec = exec }(hledgerExec)
+	hledgerExec = func(args ...string) ([]byte, []byte, error) {
+		return []byte(`          $-2,700.00  assets:bank
+             £120.00  assets:pounds
+--------------------
+          $-2,700.00
+             £120.00
+`), nil, nil
+	}
+	setValuation(t, "", false)
+	if err := collectBalances("assets", assetGauge, ledgerTotalAssets); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := published(assetGauge, "pounds", ""); !ok {
+		t.Fatal("pounds not published with an empty currency")
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(assetGauge, ledgerTotalAssets)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range checkInvariants(families, clock()) {
+		t.Error(err)
+	}
+}
+
+func TestPayeeValuation(t *testing.T) {
+	setValuation(t, "then", true)
+	defer func(exec func(...string) ([]byte, []byte, error)) { hledgerExec = exec }(hledgerExec)
+	var printArgs []string
+	hledgerExec = func(args ...string) ([]byte, []byte, error) {
+		printArgs = args
+		return nil, nil, nil
+	}
+	if err := collectExpenseTotalsByPayee(); err != nil {
+		t.Fatal(err)
+	}
+	// gross and refunds must be valued like ledger_expenses_monthly
+	i := slices.Index(printArgs, "--")
+	if i < 0 || !slices.Contains(printArgs[:i], "--infer-market-prices") || !slices.Contains(printArgs[:i], "then,$") {
+		t.Errorf("payee print ran with %q, want the valuation flags", printArgs)
+	}
+}
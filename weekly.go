@@ -0,0 +1,210 @@
+// License: MIT
+// Copyright (c) 2025 qualialog
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ledgerExpensesWoWDelta = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_expenses_wow_delta",
+			Help: "Expenses of the last 7 days minus those of the 7 days before, by category and currency",
+		},
+		[]string{"category", "currency"},
+	)
+
+	ledgerIncomeLastWeek = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_income_last_week",
+			Help: "Income of the last full week, Monday to Sunday, by currency",
+		},
+		[]string{"currency"},
+	)
+
+	ledgerTotalAssets7dDelta = newGaugeFamily(
+		prometheus.GaugeOpts{
+			Name: "ledger_total_assets_7d_delta",
+			Help: "Change of ledger_total_assets over the last 7 days by currency, absent without a snapshot from back then",
+		},
+		[]string{"currency"},
+	)
+)
+
+const (
+	assetHistoryFile = "assets_history.json"
+	// assetHistoryStep is the least time between two kept snapshots, which
+	// bounds the history to a couple of hundred entries.
+	assetHistoryStep = time.Hour
+	// assetHistoryRetention keeps a day more than the delta needs.
+	assetHistoryRetention = 8 * 24 * time.Hour
+	// assetDeltaSlack is how much older than 7 days the reference snapshot
+	// may be. When the exporter was down for longer around that time there
+	// is no honest delta and the series is left out.
+	assetDeltaSlack = 12 * time.Hour
+)
+
+type assetSnapshot struct {
+	Time   time.Time          `json:"time"`
+	Totals map[string]float64 `json:"totals"`
+}
+
+// assetHistoryState is the file format in STATE_DIR.
+type assetHistoryState struct {
+	Version   int             `json:"version"`
+	Snapshots []assetSnapshot `json:"snapshots"`
+}
+
+// assetHistory remembers ledger_total_assets across refreshes, oldest
+// first, and across restarts when STATE_DIR is set.
+type assetHistory struct {
+	mu        sync.Mutex
+	loaded    bool
+	snapshots []assetSnapshot
+}
+
+var assetsHistory assetHistory
+
+func (h *assetHistory) load() {
+	if h.loaded || cfg.StateDir == "" {
+		h.loaded = true
+		return
+	}
+	h.loaded = true
+	data, err := os.ReadFile(filepath.Join(cfg.StateDir, assetHistoryFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	var state assetHistoryState
+	if err == nil {
+		err = json.Unmarshal(data, &state)
+	}
+	if err == nil && state.Version != 1 {
+		err = fmt.Errorf("unknown version %d", state.Version)
+	}
+	if err != nil {
+		log.Printf("WARNING: discarding asset history: %v", err)
+		return
+	}
+	h.snapshots = state.Snapshots
+}
+
+func (h *assetHistory) save() error {
+	if cfg.StateDir == "" {
+		return nil
+	}
+	data, err := json.Marshal(assetHistoryState{Version: 1, Snapshots: h.snapshots})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(cfg.StateDir, assetHistoryFile), data)
+}
+
+// record adds the totals of now unless the last snapshot is too recent,
+// and drops what has aged out.
+func (h *assetHistory) record(now time.Time, totals map[string]float64) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.load()
+	if n := len(h.snapshots); n > 0 && now.Sub(h.snapshots[n-1].Time) < assetHistoryStep {
+		return nil
+	}
+	h.snapshots = append(h.snapshots, assetSnapshot{Time: now, Totals: totals})
+	i := 0
+	for i < len(h.snapshots) && now.Sub(h.snapshots[i].Time) > assetHistoryRetention {
+		i++
+	}
+	h.snapshots = h.snapshots[i:]
+	return h.save()
+}
+
+// at returns the newest snapshot taken at or before t, unless that is more
+// than assetDeltaSlack before t.
+func (h *assetHistory) at(t time.Time) (assetSnapshot, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.load()
+	for i := len(h.snapshots) - 1; i >= 0; i-- {
+		s := h.snapshots[i]
+		if !s.Time.After(t) {
+			return s, t.Sub(s.Time) <= assetDeltaSlack
+		}
+	}
+	return assetSnapshot{}, false
+}
+
+// collectWeekly computes the week over week comparisons. It runs after the
+// balances collector and reads its ledger_total_assets.
+func collectWeekly() error {
+	log.Println("collectWeekly called")
+	now := clock()
+	y, m, d := now.Date()
+	tomorrow := time.Date(y, m, d, 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1)
+
+	last, err := expensesBetween("weekly", tomorrow.AddDate(0, 0, -7), tomorrow)
+	if err != nil {
+		return err
+	}
+	before, err := expensesBetween("weekly", tomorrow.AddDate(0, 0, -14), tomorrow.AddDate(0, 0, -7))
+	if err != nil {
+		return err
+	}
+	wow := newSampleSet()
+	for _, s := range last.samples {
+		wow.add(s.value, s.labels...)
+	}
+	for _, s := range before.samples {
+		wow.add(-s.value, s.labels...)
+	}
+
+	// Monday is day 0 of the week here
+	monday := tomorrow.AddDate(0, 0, -1-(int(now.Weekday())+6)%7)
+	_, income, err := balanceBetween("weekly", "income", monday.AddDate(0, 0, -7), monday)
+	if err != nil {
+		return err
+	}
+	lastWeek := newSampleSet()
+	for _, s := range income.samples {
+		// hledger books income as negative
+		lastWeek.set(-s.value, s.labels...)
+	}
+
+	assetDelta := newSampleSet()
+	totals := map[string]float64{}
+	for _, s := range ledgerTotalAssets.snapshot() {
+		totals[s.labels[0]] = s.value
+	}
+	if len(totals) > 0 {
+		// snapshots are taken in real time, whatever REPORT_END pins
+		// the report periods to
+		observed := time.Now()
+		if ref, ok := assetsHistory.at(observed.Add(-7 * 24 * time.Hour)); ok {
+			for currency, v := range totals {
+				assetDelta.set(v-ref.Totals[currency], currency)
+			}
+			for currency, v := range ref.Totals {
+				if _, ok := totals[currency]; !ok {
+					assetDelta.set(-v, currency)
+				}
+			}
+		}
+		if err := assetsHistory.record(observed, totals); err != nil {
+			log.Printf("saving asset history: %v", err)
+		}
+	}
+
+	ledgerExpensesWoWDelta.publish(wow)
+	ledgerIncomeLastWeek.publish(lastWeek)
+	ledgerTotalAssets7dDelta.publish(assetDelta)
+	return nil
+}